@@ -1,7 +1,12 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"api/server"
@@ -10,6 +15,11 @@ import (
 )
 
 func main() {
+	// go run . verify-audit -pub <base64 ed25519> logs/audit.log
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		os.Exit(verifyAudit(os.Args[2:]))
+	}
+
 	cfg := server.Config{
 		Addr:        8080,
 		BasePath:    "/api/v1",
@@ -28,12 +38,39 @@ func main() {
 		PerRequest: server.TimeoutConfig{
 			RequestTimeout:       3 * time.Second, // пер‑запросный timeout
 			GatewayTimeoutStatus: 504,
+			ClientDeadlineHeader: server.RequestTimeoutHeader, // бюджет от gateway
+			ClientTimeoutMin:     100 * time.Millisecond,
+		},
+		Limits: server.LimitsConfig{
+			MaxBodyBytes:   1 << 20, // 1MB на JSON
+			MaxHeaderCount: 100,
+			MinBodyRate:    1 << 10, // 1KB/s
+		},
+		RateLimit: server.RateLimitConfig{
+			Rules: []server.RateLimitRule{
+				{Name: "ip", By: []server.RateLimitKey{server.RateByIP}, Limit: 600, Window: time.Minute},
+			},
+		},
+		Concurrency: server.ConcurrencyConfig{
+			Algorithm: server.ConcurrencyGradient,
+			Limit:     200,
+			QueueSize: 100,
+			MaxWait:   500 * time.Millisecond,
 		},
 		Log: server.LogConfig{
 			AccessFile:         "logs/access.log",
 			ErrorFile:          "logs/error.log",
 			RotateMaxSizeBytes: 10 << 20, // 10MB
 			RotateBackups:      5,
+			RotateEvery:        server.RotateDaily,
+			RotateMaxAge:       30 * 24 * time.Hour,
+			RotateCompress:     "gzip",
+			AccessFormat:       server.LogFormatJSON,
+			// health‑пробы: 1% успешных, ошибки — все
+			AccessSampling: []server.AccessSampleRule{{Route: "/api/v1/livez", Status: "2xx", Rate: 0.01}},
+			AuditFile:      "logs/audit.log",
+			// подписанные checkpoint'ы — ключ из секрет‑хранилища:
+			// Audit: server.AuditConfig{SigningKey: key, CheckpointInterval: time.Hour},
 		},
 		Auth: server.AuthConfig{
 			AuthHeader:             "Authorization",
@@ -50,11 +87,11 @@ func main() {
 	srv, err := server.New(
 		cfg,
 		server.WithTokenValidator(val),
-		server.WithRegistrar(server.HandlerFuncRegistrar(func(r *gin.RouterGroup) {
+		server.WithRoutes(server.RoutesFunc(func(r *server.Routes) {
 			// защищённые эндпоинты (access мидлвар уже повешен на root, см. cfg.Auth)
 			r.GET("/me", func(c *gin.Context) {
-				claims, _ := c.Get("access_claims")
-				c.JSON(http.StatusOK, gin.H{"ok": true, "claims": claims})
+				claims, _ := server.GetClaims(c)
+				c.JSON(http.StatusOK, gin.H{"ok": true, "sub": server.MustSubject(c), "claims": claims})
 			})
 			// «длинная» операция (проверяем timeout)
 			r.GET("/slow", func(c *gin.Context) {
@@ -67,7 +104,7 @@ func main() {
 				}
 			})
 			// обмен refresh -> access (вешай RefreshMiddleware только здесь, если нужно)
-			r.POST("/auth/refresh", server.AuthOnly(val, false), func(c *gin.Context) {
+			r.POST("/auth/refresh", r.RefreshMiddleware(), func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"ok": true, "new": "token"})
 			})
 		})),
@@ -79,3 +116,33 @@ func main() {
 		panic(err)
 	}
 }
+
+// verifyAudit — проверка журнала аудита и его бэкапов; код выхода 1 — журнал повреждён.
+func verifyAudit(args []string) int {
+	fs := flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	pub := fs.String("pub", "", "публичный ключ checkpoint'ов (base64); пусто — только hash‑цепочка")
+	every := fs.Int("every", 0, "AuditConfig.CheckpointEvery; 0 — по умолчанию")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: verify-audit [-pub key] [-every n] <audit.log>")
+		return 2
+	}
+	var key ed25519.PublicKey
+	if *pub != "" {
+		raw, err := base64.StdEncoding.DecodeString(*pub)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			fmt.Fprintln(os.Stderr, "invalid -pub")
+			return 2
+		}
+		key = raw
+	}
+	rep, err := server.VerifyAuditFile(fs.Arg(0), key, *every)
+	fmt.Printf("records=%d checkpoints=%d seq=%d..%d unsigned=%d recovered=%d\n",
+		rep.Records, rep.Checkpoints, rep.FirstSeq, rep.LastSeq, rep.Unsigned, rep.Recovered)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "FAIL:", err)
+		return 1
+	}
+	fmt.Println("OK")
+	return 0
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Поля access‑лога (LogConfig.AccessFields).
+const (
+	AccessFieldRequestID = "request_id"
+	AccessFieldMethod    = "method"
+	AccessFieldPath      = "path"  // фактический путь
+	AccessFieldRoute     = "route" // шаблон роута: /users/:id
+	AccessFieldStatus    = "status"
+	AccessFieldBytesIn   = "bytes_in"
+	AccessFieldBytesOut  = "bytes_out"
+	AccessFieldLatency   = "latency_ms"
+	AccessFieldIP        = "ip"
+	AccessFieldUserAgent = "user_agent"
+	AccessFieldSubject   = "sub"
+	AccessFieldActor     = "act"    // цепочка actor'ов при impersonation
+	AccessFieldTenant    = "tenant" // только если tenant определён
+	AccessFieldError     = "error"  // c.Errors, если есть
+)
+
+var defaultAccessFields = []string{
+	AccessFieldRequestID, AccessFieldMethod, AccessFieldPath, AccessFieldRoute,
+	AccessFieldStatus, AccessFieldBytesIn, AccessFieldBytesOut, AccessFieldLatency,
+	AccessFieldIP, AccessFieldUserAgent, AccessFieldSubject, AccessFieldActor,
+	AccessFieldTenant, AccessFieldError,
+}
+
+// Форматы LogConfig.AccessFormat.
+const (
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
+// newSlogHandler — JSON или logfmt (key=value) поверх w.
+func newSlogHandler(w io.Writer, format string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch format {
+	case "", LogFormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	case LogFormatLogfmt:
+		return slog.NewTextHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("log: unknown format %q (json, logfmt)", format)
+}
+
+// accessLogger — одна запись на запрос, msg="access".
+type accessLogger struct {
+	log     *slog.Logger
+	red     *redactor
+	fields  map[string]bool
+	sampler atomic.Pointer[accessSampler] // меняется через /sys/log/sampling
+}
+
+func newAccessLogger(w io.Writer, cfg LogConfig, red *redactor, levels *logLevels) (*accessLogger, error) {
+	h, err := newSlogHandler(w, cfg.AccessFormat, &slog.HandlerOptions{Level: slog.LevelDebug})
+	if err != nil {
+		return nil, err
+	}
+	sampler, err := newAccessSampler(cfg.AccessSampling)
+	if err != nil {
+		return nil, err
+	}
+	fields := cfg.AccessFields
+	if len(fields) == 0 {
+		fields = defaultAccessFields
+	}
+	a := &accessLogger{log: slog.New(levels.handler(LogModuleAccess, red.handler(h))), red: red, fields: map[string]bool{}}
+	a.sampler.Store(sampler)
+	for _, f := range fields {
+		if !containsString(defaultAccessFields, f) {
+			return nil, fmt.Errorf("log: unknown access field %q", f)
+		}
+		a.fields[f] = true
+	}
+	return a, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware — ставится первым: latency включает все мидлвары.
+func (a *accessLogger) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		var in *countingBody
+		if a.fields[AccessFieldBytesIn] && c.Request.Body != nil && c.Request.Body != http.NoBody {
+			in = &countingBody{ReadCloser: c.Request.Body}
+			c.Request.Body = in
+		}
+		// путь до роутинга: tenant‑префикс уже вырезан, а хендлеры могут переписать URL
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path += "?" + a.red.Query(raw)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		if !a.log.Enabled(c.Request.Context(), level) {
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path // 404: правила по пути
+		}
+		rate, ok := a.sampler.Load().sample(c.Request.Method, route, status)
+		if !ok {
+			return
+		}
+
+		attrs := make([]slog.Attr, 0, len(a.fields))
+		add := func(field string, v slog.Value) {
+			if a.fields[field] {
+				attrs = append(attrs, slog.Attr{Key: field, Value: v})
+			}
+		}
+		add(AccessFieldRequestID, slog.StringValue(c.GetString("request_id")))
+		add(AccessFieldMethod, slog.StringValue(c.Request.Method))
+		add(AccessFieldPath, slog.StringValue(path))
+		add(AccessFieldRoute, slog.StringValue(c.FullPath()))
+		add(AccessFieldStatus, slog.IntValue(status))
+		if in != nil {
+			add(AccessFieldBytesIn, slog.Int64Value(in.n))
+		} else {
+			add(AccessFieldBytesIn, slog.Int64Value(0))
+		}
+		add(AccessFieldBytesOut, slog.IntValue(max(0, c.Writer.Size())))
+		add(AccessFieldLatency, slog.Float64Value(float64(time.Since(start).Microseconds())/1000))
+		add(AccessFieldIP, slog.StringValue(c.ClientIP()))
+		add(AccessFieldUserAgent, slog.StringValue(c.Request.UserAgent()))
+		if cl, ok := c.Keys[AccessClaimsKey].(Claims); ok {
+			add(AccessFieldSubject, slog.StringValue(cl.Subject()))
+			if chain := cl.ActorChain(); len(chain) > 0 {
+				add(AccessFieldActor, slog.StringValue(strings.Join(chain, ">")))
+			}
+		}
+		if t := Tenant(c); t != "" {
+			add(AccessFieldTenant, slog.StringValue(t))
+		}
+		if len(c.Errors) > 0 {
+			add(AccessFieldError, slog.StringValue(strings.Join(c.Errors.Errors(), "; ")))
+		}
+		if rate < 1 {
+			attrs = append(attrs, slog.Float64("sample_rate", rate)) // для пересчёта в аналитике
+		}
+		a.log.LogAttrs(c.Request.Context(), level, "access", attrs...)
+	}
+}
+
+// countingBody — сколько байт тела реально прочитано.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	k, err := b.ReadCloser.Read(p)
+	b.n += int64(k)
+	return k, err
+}
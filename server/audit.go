@@ -0,0 +1,665 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// События, которые пишет сам журнал.
+const (
+	AuditEventStart      = "audit.start"      // запуск сервера (продолжение цепочки или новая)
+	AuditEventCheckpoint = "audit.checkpoint" // подпись Ed25519 головы цепочки
+	AuditEventRecovered  = "audit.recovered"  // при запуске: битый хвост (обрыв записи) отброшен
+)
+
+var (
+	ErrAuditUnavailable = errors.New("audit: not configured")
+	// VerifyAudit
+	ErrAuditMalformed = errors.New("audit: malformed record")
+	ErrAuditTampered  = errors.New("audit: record hash mismatch") // запись изменена
+	ErrAuditGap       = errors.New("audit: sequence gap")         // запись удалена или вставлена
+	ErrAuditChain     = errors.New("audit: broken hash chain")    // prev не совпадает с hash предыдущей
+	ErrAuditSignature = errors.New("audit: invalid checkpoint signature")
+	ErrAuditUnsigned  = errors.New("audit: records not covered by a checkpoint") // с ключом: нет подписей
+)
+
+// defaultAuditCheckpointEvery — AuditConfig.CheckpointEvery по умолчанию.
+const defaultAuditCheckpointEvery = 1000
+
+const auditKey = "audit"
+
+// auditLinePrefix — так начинается каждая запись; посторонние строки
+// (скажем, журнал собран из syslog) VerifyAudit пропускает.
+var auditLinePrefix = []byte(`{"seq":`)
+
+// Audit — записать событие в журнал аудита сервера:
+//
+//	if err := server.Audit(c, "order.refund", map[string]any{"order_id": id}); err != nil { ... }
+//
+// request_id, ip, метод, путь, sub/act и tenant берутся из c.
+func Audit(c *gin.Context, event string, fields map[string]any) error {
+	a, ok := auditFrom(c)
+	if !ok {
+		return ErrAuditUnavailable
+	}
+	return a.Record(c, event, fields)
+}
+
+func auditFrom(c *gin.Context) (*auditLogger, bool) {
+	if c == nil {
+		return nil, false
+	}
+	a, ok := c.Get(auditKey)
+	if !ok {
+		return nil, false
+	}
+	return a.(*auditLogger), true
+}
+
+// auditRecord — одна строка журнала. hash = sha256 строки без поля hash;
+// prev — hash предыдущей записи, поэтому изменение/удаление любой записи видно.
+type auditRecord struct {
+	Seq       int64          `json:"seq"`
+	Time      string         `json:"time"`
+	Event     string         `json:"event"`
+	RequestID string         `json:"request_id,omitempty"`
+	IP        string         `json:"ip,omitempty"`
+	Method    string         `json:"method,omitempty"`
+	Path      string         `json:"path,omitempty"`
+	Subject   string         `json:"sub,omitempty"`
+	Actor     string         `json:"act,omitempty"`
+	Tenant    string         `json:"tenant,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	Prev      string         `json:"prev"`
+	Hash      string         `json:"hash,omitempty"`
+}
+
+// auditLogger — журнал значимых событий безопасности с hash‑цепочкой
+// и периодическими подписанными checkpoint'ами (LogConfig.Audit).
+// nil‑safe: Record на nil ничего не пишет.
+type auditLogger struct {
+	w       io.Writer
+	red     *redactor
+	key     ed25519.PrivateKey
+	every   int
+	onError func(error)
+	now     func() time.Time
+
+	mu      sync.Mutex
+	seq     int64
+	head    string // hash последней записи
+	pending int    // записей после последнего checkpoint'а
+
+	stop  chan struct{}
+	done  chan struct{}
+	close sync.Once
+}
+
+// newAuditLogger — path — файл, куда пишет w (AuditFile): цепочка продолжается с последней
+// целой записи в нём (или в последнем бэкапе). Пустой path — новая цепочка.
+func newAuditLogger(w io.Writer, path string, cfg AuditConfig, red *redactor, onError func(error)) (*auditLogger, error) {
+	if cfg.CheckpointInterval > 0 && cfg.SigningKey == nil {
+		return nil, errors.New("audit: CheckpointInterval requires SigningKey")
+	}
+	a := &auditLogger{
+		w:       w,
+		red:     red,
+		key:     cfg.SigningKey,
+		every:   cfg.CheckpointEvery,
+		onError: onError,
+		now:     time.Now,
+	}
+	if a.every == 0 {
+		a.every = defaultAuditCheckpointEvery
+	}
+	resumed := false
+	if path != "" {
+		tail, err := readAuditTail(path)
+		if err != nil {
+			return nil, fmt.Errorf("audit: cannot resume chain: %w", err)
+		}
+		if tail.last != nil {
+			a.seq, a.head, resumed = tail.last.Seq, tail.last.Hash, true
+		}
+		if tail.unterminated {
+			// оборванная строка не должна склеиться со следующей записью
+			if err := appendNewline(path); err != nil {
+				return nil, fmt.Errorf("audit: %w", err)
+			}
+		}
+		if len(tail.bad) > 0 {
+			// цепочка идёт дальше от последней целой записи; отброшенное фиксируется
+			// записью, по которой VerifyAudit узнаёт эти строки
+			err := a.append(auditRecord{Event: AuditEventRecovered, Fields: map[string]any{
+				"discarded":        len(tail.bad),
+				"discarded_sha256": discardedHash(tail.bad),
+			}})
+			if err != nil {
+				a.onError(err)
+			}
+		}
+	}
+	if err := a.append(auditRecord{Event: AuditEventStart, Fields: map[string]any{"resumed": resumed}}); err != nil {
+		a.onError(err)
+	}
+	// неподписанный хвост прошлого запуска подписывается сразу
+	if err := a.Checkpoint(); err != nil {
+		a.onError(err)
+	}
+	if cfg.CheckpointInterval > 0 {
+		a.stop, a.done = make(chan struct{}), make(chan struct{})
+		go a.ticker(cfg.CheckpointInterval)
+	}
+	return a, nil
+}
+
+// Middleware — делает журнал доступным для server.Audit(c, ...).
+func (a *auditLogger) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auditKey, a)
+		c.Next()
+	}
+}
+
+func (a *auditLogger) Record(c *gin.Context, event string, fields map[string]any) error {
+	if a == nil {
+		return nil
+	}
+	rec := auditRecord{Event: event}
+	if len(fields) > 0 {
+		rec.Fields, _ = a.red.value(map[string]any(fields)).(map[string]any)
+	}
+	if c != nil {
+		rec.RequestID = c.GetString("request_id")
+		rec.IP = c.ClientIP()
+		rec.Method = c.Request.Method
+		rec.Path = c.Request.URL.Path
+		rec.Tenant = Tenant(c)
+		cl, ok := GetClaims(c)
+		if !ok {
+			cl, ok = claimsFrom(c, RefreshClaimsKey)
+		}
+		if ok {
+			rec.Subject = cl.Subject()
+			rec.Actor = strings.Join(cl.ActorChain(), ">")
+		}
+	}
+	return a.append(rec)
+}
+
+func (a *auditLogger) append(rec auditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.writeLocked(rec); err != nil {
+		return err
+	}
+	a.pending++
+	if a.key != nil && a.every > 0 && a.pending >= a.every {
+		return a.checkpointLocked()
+	}
+	return nil
+}
+
+func (a *auditLogger) writeLocked(rec auditRecord) error {
+	rec.Seq = a.seq + 1
+	rec.Time = a.now().UTC().Format(time.RFC3339Nano)
+	rec.Prev = a.head
+	line, hash, err := sealAuditRecord(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := a.w.Write(line); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	a.seq, a.head = rec.Seq, hash
+	return nil
+}
+
+// Checkpoint — подписать текущую голову цепочки (если есть новые записи и ключ).
+func (a *auditLogger) Checkpoint() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.key == nil || a.pending == 0 {
+		return nil
+	}
+	return a.checkpointLocked()
+}
+
+func (a *auditLogger) checkpointLocked() error {
+	sig := ed25519.Sign(a.key, checkpointMessage(a.seq, a.head))
+	err := a.writeLocked(auditRecord{Event: AuditEventCheckpoint, Fields: map[string]any{
+		"head":     a.head,
+		"head_seq": a.seq,
+		"key":      base64.StdEncoding.EncodeToString(a.key.Public().(ed25519.PublicKey)),
+		"sig":      base64.StdEncoding.EncodeToString(sig),
+	}})
+	if err == nil {
+		a.pending = 0
+	}
+	return err
+}
+
+func checkpointMessage(seq int64, head string) []byte {
+	return fmt.Appendf(nil, "audit-checkpoint:%d:%s", seq, head)
+}
+
+func (a *auditLogger) ticker(every time.Duration) {
+	defer close(a.done)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := a.Checkpoint(); err != nil {
+				a.onError(err)
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Close — финальный checkpoint; сам writer закрывает сервер.
+func (a *auditLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.close.Do(func() {
+		if a.stop != nil {
+			close(a.stop)
+			<-a.done
+		}
+	})
+	return a.Checkpoint()
+}
+
+// sealAuditRecord — строка JSON с hash в конце и сам hash.
+func sealAuditRecord(rec auditRecord) ([]byte, string, error) {
+	rec.Hash = ""
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return nil, "", fmt.Errorf("audit: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	line := append(body[:len(body)-1], `,"hash":"`+hash+`"}`+"\n"...)
+	return line, hash, nil
+}
+
+// parseAuditLine — запись и проверка её hash (строка без '\n').
+func parseAuditLine(line []byte) (auditRecord, error) {
+	var rec auditRecord
+	if err := json.Unmarshal(line, &rec); err != nil || rec.Hash == "" {
+		return rec, ErrAuditMalformed
+	}
+	suffix := []byte(`,"hash":"` + rec.Hash + `"}`)
+	if !bytes.HasSuffix(line, suffix) {
+		return rec, ErrAuditMalformed
+	}
+	body := append(bytes.Clone(line[:len(line)-len(suffix)]), '}')
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != rec.Hash {
+		return rec, ErrAuditTampered
+	}
+	return rec, nil
+}
+
+// auditTail — конец журнала для продолжения цепочки.
+type auditTail struct {
+	last         *auditRecord // последняя целая запись; nil — журнала нет
+	bad          [][]byte     // битые записи после неё (обрыв при падении, порча)
+	unterminated bool         // файл не заканчивается '\n'
+}
+
+// readAuditTail — хвост path, а если там нет целых записей (файл только что
+// ротирован) — ещё и самого свежего бэкапа.
+func readAuditTail(path string) (auditTail, error) {
+	tail, err := readAuditTailInFile(path)
+	if tail.last != nil || err != nil {
+		return tail, err
+	}
+	w := &rotatingWriter{path: path, backupRe: backupRegexp(path)}
+	for _, b := range w.listBackups() {
+		r, err := openLogFile(b.path)
+		if err != nil {
+			return tail, err
+		}
+		var (
+			last *auditRecord
+			bad  [][]byte
+		)
+		err = scanLines(r, func(line []byte) error {
+			if !bytes.HasPrefix(line, auditLinePrefix) {
+				return nil
+			}
+			if rec, err := parseAuditLine(line); err == nil {
+				last, bad = &rec, nil
+			} else {
+				bad = append(bad, bytes.Clone(line))
+			}
+			return nil
+		})
+		r.Close()
+		if err != nil {
+			return tail, err
+		}
+		if last != nil || len(bad) > 0 {
+			tail.last, tail.bad = last, append(bad, tail.bad...)
+			if last != nil {
+				break
+			}
+		}
+	}
+	return tail, nil
+}
+
+// readAuditTailInFile — читает несжатый файл с конца, кусками, до первой целой записи.
+func readAuditTailInFile(path string) (auditTail, error) {
+	var tail auditTail
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tail, nil
+	}
+	if err != nil {
+		return tail, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return tail, err
+	}
+	const chunk = 64 << 10
+	end := fi.Size()
+	if end > 0 {
+		var b [1]byte
+		if _, err := f.ReadAt(b[:], end-1); err != nil {
+			return tail, err
+		}
+		tail.unterminated = b[0] != '\n'
+	}
+	var rest []byte // неполная первая строка предыдущего куска
+	for end > 0 {
+		n := min(end, chunk)
+		buf := make([]byte, n, int(n)+len(rest))
+		if _, err := f.ReadAt(buf, end-n); err != nil {
+			return tail, err
+		}
+		end -= n
+		lines := bytes.Split(append(buf, rest...), []byte("\n"))
+		first := 0
+		if end > 0 {
+			first = 1 // может начинаться в предыдущем куске
+		}
+		for i := len(lines) - 1; i >= first; i-- {
+			if !bytes.HasPrefix(lines[i], auditLinePrefix) {
+				continue
+			}
+			rec, err := parseAuditLine(lines[i])
+			if err == nil {
+				tail.last = &rec
+				return tail, nil
+			}
+			tail.bad = append([][]byte{bytes.Clone(lines[i])}, tail.bad...)
+		}
+		rest = lines[0]
+	}
+	return tail, nil
+}
+
+func appendNewline(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte("\n"))
+	return errors.Join(err, f.Close())
+}
+
+// discardedHash — sha256 отброшенных строк (через '\n'), см. AuditEventRecovered.
+func discardedHash(lines [][]byte) string {
+	sum := sha256.Sum256(bytes.Join(lines, []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// openLogFile — файл лога; сжатые бэкапы (.gz и т.п.) распаковываются.
+func openLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	for _, c := range compressors {
+		if c.Ext == "" || !strings.HasSuffix(path, c.Ext) {
+			continue
+		}
+		if c.NewReader == nil {
+			f.Close()
+			return nil, fmt.Errorf("log: no reader for %s", c.Ext)
+		}
+		zr, err := c.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{zr, closers{zr, f}}, nil
+	}
+	return f, nil
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var errs []error
+	for _, c := range cs {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// scanLines — построчно, без ограничения длины строки; '\n' отрезается.
+func scanLines(r io.Reader, fn func(line []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if ferr := fn(bytes.TrimSuffix(line, []byte("\n"))); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// AuditReport — итог проверки журнала.
+type AuditReport struct {
+	Records     int // записей (включая служебные)
+	Checkpoints int
+	FirstSeq    int64 // первая запись может быть > 1, если старые бэкапы удалены
+	LastSeq     int64
+	LastHash    string
+	// записей после последнего checkpoint'а: их целостность подтверждает только цепочка
+	Unsigned int
+	// битых строк, отброшенных при перезапуске (AuditEventRecovered)
+	Recovered int
+}
+
+// auditVerifier — состояние проверки, переходящее через границы файлов.
+type auditVerifier struct {
+	pub    ed25519.PublicKey
+	every  int
+	report AuditReport
+	bad    [][]byte // битые строки подряд — допустимы, только если дальше AuditEventRecovered
+	badErr error    // ошибка первой из них
+}
+
+// VerifyAudit — проверить журнал из r: hash каждой записи, непрерывность seq,
+// цепочку prev и подписи checkpoint'ов ключом pub (nil — только цепочка).
+// С ключом журнал без checkpoint'ов или с хвостом длиннее every неподписанных
+// записей (AuditConfig.CheckpointEvery; 0 — по умолчанию) — ErrAuditUnsigned.
+// Первая найденная ошибка — одна из ErrAudit*, с номером строки.
+func VerifyAudit(r io.Reader, pub ed25519.PublicKey, every int) (AuditReport, error) {
+	v := newAuditVerifier(pub, every)
+	if err := v.read("", r); err != nil {
+		return v.report, err
+	}
+	return v.report, v.finish()
+}
+
+// VerifyAuditFile — VerifyAudit по файлу и всем его ротированным бэкапам
+// (от старых к новым, сжатые распаковываются).
+func VerifyAuditFile(path string, pub ed25519.PublicKey, every int) (AuditReport, error) {
+	v := newAuditVerifier(pub, every)
+	w := &rotatingWriter{path: path, backupRe: backupRegexp(path)}
+	backups := w.listBackups()
+	files := make([]string, 0, len(backups)+1)
+	for i := len(backups) - 1; i >= 0; i-- {
+		files = append(files, backups[i].path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	for _, name := range files {
+		r, err := openLogFile(name)
+		if err != nil {
+			return v.report, err
+		}
+		err = v.read(name, r)
+		r.Close()
+		if err != nil {
+			return v.report, err
+		}
+	}
+	return v.report, v.finish()
+}
+
+func newAuditVerifier(pub ed25519.PublicKey, every int) *auditVerifier {
+	if every <= 0 {
+		every = defaultAuditCheckpointEvery
+	}
+	return &auditVerifier{pub: pub, every: every}
+}
+
+// finish — проверки конца журнала.
+func (v *auditVerifier) finish() error {
+	if v.badErr != nil {
+		return v.badErr
+	}
+	rep := v.report
+	if v.pub == nil || rep.Records == 0 {
+		return nil
+	}
+	if rep.Checkpoints == 0 {
+		return ErrAuditUnsigned
+	}
+	if rep.Unsigned > v.every {
+		return fmt.Errorf("%d records after seq %d: %w", rep.Unsigned, rep.LastSeq-int64(rep.Unsigned), ErrAuditUnsigned)
+	}
+	return nil
+}
+
+func (v *auditVerifier) read(name string, r io.Reader) error {
+	n := 0
+	return scanLines(r, func(line []byte) error {
+		n++
+		if !bytes.HasPrefix(line, auditLinePrefix) {
+			return nil
+		}
+		at := fmt.Sprintf("line %d", n)
+		if name != "" {
+			at = fmt.Sprintf("%s:%d", name, n)
+		}
+		rec, err := parseAuditLine(line)
+		if err != nil {
+			// возможно, обрыв записи при падении — решит следующая целая запись
+			if v.badErr == nil {
+				v.badErr = fmt.Errorf("%s: %w", at, err)
+			}
+			v.bad = append(v.bad, bytes.Clone(line))
+			return nil
+		}
+		if v.bad != nil {
+			// битые строки принимаются, только если сервер отбросил именно их
+			hash, _ := rec.Fields["discarded_sha256"].(string)
+			if rec.Event != AuditEventRecovered || hash != discardedHash(v.bad) {
+				return v.badErr
+			}
+			v.report.Recovered += len(v.bad)
+			v.bad, v.badErr = nil, nil
+		}
+		if err := v.record(rec); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+		return nil
+	})
+}
+
+func (v *auditVerifier) record(rec auditRecord) error {
+	rep := &v.report
+	if rep.Records > 0 {
+		if rec.Seq != rep.LastSeq+1 {
+			return fmt.Errorf("seq %d after %d: %w", rec.Seq, rep.LastSeq, ErrAuditGap)
+		}
+		if rec.Prev != rep.LastHash {
+			return fmt.Errorf("seq %d: %w", rec.Seq, ErrAuditChain)
+		}
+	} else {
+		rep.FirstSeq = rec.Seq
+	}
+	if rec.Event == AuditEventCheckpoint {
+		if err := v.checkpoint(rec); err != nil {
+			return fmt.Errorf("seq %d: %w", rec.Seq, err)
+		}
+		rep.Checkpoints++
+		rep.Unsigned = 0
+	} else {
+		rep.Unsigned++
+	}
+	rep.Records++
+	rep.LastSeq, rep.LastHash = rec.Seq, rec.Hash
+	return nil
+}
+
+func (v *auditVerifier) checkpoint(rec auditRecord) error {
+	head, _ := rec.Fields["head"].(string)
+	seq, _ := rec.Fields["head_seq"].(float64)
+	if head != rec.Prev || int64(seq) != rec.Seq-1 {
+		return ErrAuditSignature
+	}
+	if v.pub == nil {
+		return nil
+	}
+	key, _ := rec.Fields["key"].(string)
+	sig, _ := rec.Fields["sig"].(string)
+	rawSig, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || key != base64.StdEncoding.EncodeToString(v.pub) ||
+		!ed25519.Verify(v.pub, checkpointMessage(int64(seq), head), rawSig) {
+		return ErrAuditSignature
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -17,8 +18,12 @@ type TokenValidator interface {
 }
 
 type Auth struct {
-	cfg       AuthConfig
-	validator TokenValidator
+	cfg          AuthConfig
+	validator    TokenValidator
+	impersonator Impersonator
+	audit        *auditLogger
+	tenants      *tenants
+	store        TokenStore
 }
 
 func newAuth(cfg AuthConfig, v TokenValidator) *Auth {
@@ -28,6 +33,12 @@ func newAuth(cfg AuthConfig, v TokenValidator) *Auth {
 	if cfg.BearerPrefix == "" {
 		cfg.BearerPrefix = "Bearer "
 	}
+	if cfg.ImpersonationHeader != "" && cfg.ImpersonationPermission == "" {
+		cfg.ImpersonationPermission = "impersonate"
+	}
+	if cfg.SysAdminPermission == "" {
+		cfg.SysAdminPermission = "sys:admin"
+	}
 	return &Auth{cfg: cfg, validator: v}
 }
 
@@ -41,10 +52,23 @@ func (a *Auth) AccessMiddleware() gin.HandlerFunc {
 		claims, err := a.validator.ValidateAccess(c, tok)
 		if err != nil {
 			_ = c.Error(err)
+			a.record(c, "auth.access.denied", map[string]any{"reason": "invalid_token"})
 			RespondError(c, http.StatusUnauthorized, "invalid_token", "invalid access token", nil)
 			return
 		}
-		c.Set("access_claims", claims)
+		if !a.checkRevoked(c, tok, "auth.access.denied") {
+			return
+		}
+		if a.cfg.ImpersonationHeader != "" {
+			var ok bool
+			if claims, ok = a.impersonate(c, claims); !ok {
+				return
+			}
+		}
+		if !a.tenantsFor(c).checkClaims(c, claims) {
+			return
+		}
+		c.Set(AccessClaimsKey, claims)
 		c.Next()
 	}
 }
@@ -53,20 +77,72 @@ func (a *Auth) RefreshMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tok := a.pickToken(c, false)
 		if tok == "" {
+			a.record(c, "auth.refresh.denied", map[string]any{"reason": "no_token"})
 			RespondError(c, http.StatusUnauthorized, "no_token", "refresh token missing", nil)
 			return
 		}
 		claims, err := a.validator.ValidateRefresh(c, tok)
 		if err != nil {
 			_ = c.Error(err)
+			a.record(c, "auth.refresh.denied", map[string]any{"reason": "invalid_token"})
 			RespondError(c, http.StatusUnauthorized, "invalid_token", "invalid refresh token", nil)
 			return
 		}
-		c.Set("refresh_claims", claims)
+		if !a.checkRevoked(c, tok, "auth.refresh.denied") {
+			return
+		}
+		c.Set(RefreshClaimsKey, claims)
+		a.record(c, "auth.refresh", nil)
 		c.Next()
 	}
 }
 
+// record — событие в журнал аудита: свой (Auth сервера) или из контекста
+// (Auth из AuthOnly), и в лог модуля auth (Debug). Ошибка записи уходит в c.Error,
+// запрос не прерывается. Пропущенный access‑токен не пишется — это обычный анонимный запрос.
+func (a *Auth) record(c *gin.Context, event string, fields map[string]any) {
+	if log := Logger(c); log.Enabled(c.Request.Context(), slog.LevelDebug) {
+		log.Debug(event, "module", LogModuleAuth, "fields", fields)
+	}
+	l := a.audit
+	if l == nil {
+		l, _ = auditFrom(c)
+	}
+	if err := l.Record(c, event, fields); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// checkRevoked — токен не отозван (если TokenStore подключён); отказ — событие denied.
+func (a *Auth) checkRevoked(c *gin.Context, tok, denied string) bool {
+	if a.store == nil {
+		return true
+	}
+	revoked, err := a.store.IsRevoked(c.Request.Context(), tok)
+	if err != nil {
+		_ = c.Error(err)
+		RespondError(c, http.StatusServiceUnavailable, "token_store_unavailable", "cannot verify token", nil)
+		return false
+	}
+	if revoked {
+		a.record(c, denied, map[string]any{"reason": "revoked"})
+		RespondError(c, http.StatusUnauthorized, "invalid_token", "token revoked", nil)
+		return false
+	}
+	return true
+}
+
+// tenantsFor — tenant'ы сервера: свои (Auth сервера) или из контекста
+// (Auth из AuthOnly), чтобы проверка tenant'а токена не зависела от мидлвара.
+func (a *Auth) tenantsFor(c *gin.Context) *tenants {
+	if a.tenants != nil {
+		return a.tenants
+	}
+	t, _ := c.Get(tenantsKey)
+	tn, _ := t.(*tenants)
+	return tn
+}
+
 func (a *Auth) pickToken(c *gin.Context, access bool) string {
 	// 1) Authorization: Bearer xxx
 	h := c.GetHeader(a.cfg.AuthHeader)
@@ -1,13 +1,54 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
 
 // AuthOnly — вернуть мидлвар только для выбранного роута/группы.
-// access=true -> access middleware, иначе refresh.
-func AuthOnly(v TokenValidator, access bool) gin.HandlerFunc {
+// access=true -> access middleware, иначе refresh. store — тот же TokenStore,
+// что у сервера (nil — отзыв не проверяется); роутам самого сервера проще
+// Server.AccessMiddleware/RefreshMiddleware.
+func AuthOnly(v TokenValidator, store TokenStore, access bool) gin.HandlerFunc {
 	a := newAuth(AuthConfig{AuthHeader: "Authorization", BearerPrefix: "Bearer "}, v)
+	a.store = store
 	if access {
 		return a.AccessMiddleware()
 	}
 	return a.RefreshMiddleware()
 }
+
+// RequirePermission — ставится после access middleware: 403, если у токена нет perm
+// (см. HasPermission).
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl, ok := GetClaims(c)
+		if !ok {
+			RespondError(c, http.StatusUnauthorized, "no_token", "access token missing", nil)
+			return
+		}
+		if !HasPermission(cl, perm) {
+			RespondError(c, http.StatusForbidden, "forbidden", "permission required: "+perm, nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireNoActor — ставится после access middleware: 403 для делегированных токенов
+// (impersonation, клейм "act") — управляющие маршруты только от своего имени.
+func RequireNoActor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl, ok := GetClaims(c)
+		if !ok {
+			RespondError(c, http.StatusUnauthorized, "no_token", "access token missing", nil)
+			return
+		}
+		if cl.Actor() != nil {
+			RespondError(c, http.StatusForbidden, "impersonation_forbidden", "not allowed while impersonating", nil)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Причины захвата (поле "reason" в capture‑логе).
+const (
+	CaptureReasonSample = "sample"
+	CaptureReasonHeader = "header"
+	CaptureReasonToggle = "toggle"
+)
+
+// capturer — отладочная запись тел запросов/ответов в отдельный лог (CaptureConfig).
+type capturer struct {
+	log         *slog.Logger
+	red         *redactor
+	maxBytes    int
+	rate        float64
+	routes      routeTable[float64]
+	header      string
+	headerValue string
+	exempt      func(path string) bool
+
+	mu       sync.Mutex
+	toggle   float64   // доля запросов при включении через /sys/capture
+	until    time.Time // до какого момента действует toggle
+	captured int64
+}
+
+func newCapturer(w io.Writer, cfg CaptureConfig, red *redactor, basePath string) *capturer {
+	cp := &capturer{
+		log:         slog.New(red.handler(slog.NewJSONHandler(w, nil))),
+		red:         red,
+		maxBytes:    cfg.MaxBodyBytes,
+		rate:        cfg.SampleRate,
+		routes:      newRouteTable(cfg.Routes),
+		header:      cfg.TriggerHeader,
+		headerValue: cfg.TriggerValue,
+		exempt:      func(p string) bool { return systemPath(basePath, p) },
+	}
+	if cp.maxBytes <= 0 {
+		cp.maxBytes = 64 << 10
+	}
+	return cp
+}
+
+// Toggle — включить захват на d для доли rate запросов (0 < rate <= 1);
+// d <= 0 — выключить.
+func (cp *capturer) Toggle(rate float64, d time.Duration) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if d <= 0 {
+		cp.toggle, cp.until = 0, time.Time{}
+		return
+	}
+	cp.toggle, cp.until = min(max(rate, 0), 1), time.Now().Add(d)
+}
+
+// Stats — для /sys/capture.
+func (cp *capturer) Stats() gin.H {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	out := gin.H{
+		"sample_rate": cp.rate,
+		"max_bytes":   cp.maxBytes,
+		"captured":    cp.captured,
+		"toggle":      false,
+	}
+	if time.Now().Before(cp.until) {
+		out["toggle"] = true
+		out["toggle_rate"] = cp.toggle
+		out["toggle_until"] = cp.until.Format(time.RFC3339)
+	}
+	return out
+}
+
+// reason — захватывать ли запрос и почему; "" — нет.
+func (cp *capturer) reason(c *gin.Context) string {
+	if cp.header != "" {
+		if v := c.GetHeader(cp.header); v != "" && (cp.headerValue == "" || v == cp.headerValue) {
+			return CaptureReasonHeader
+		}
+	}
+	cp.mu.Lock()
+	toggle := 0.0
+	if time.Now().Before(cp.until) {
+		toggle = cp.toggle
+	}
+	cp.mu.Unlock()
+	if toggle > 0 && rand.Float64() < toggle {
+		return CaptureReasonToggle
+	}
+	rate := cp.rate
+	if r, ok := cp.routes.lookup(c.Request.Method, c.FullPath()); ok {
+		rate = r
+	}
+	if rate > 0 && rand.Float64() < rate {
+		return CaptureReasonSample
+	}
+	return ""
+}
+
+// Middleware — ставится после RequestLogger: тело запроса пишется по мере чтения
+// хендлером, ответ — по мере записи; в лог — не больше MaxBodyBytes каждого.
+func (cp *capturer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cp.exempt(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		reason := cp.reason(c)
+		if reason == "" {
+			c.Next()
+			return
+		}
+		reqHeader := cp.red.Header(c.Request.Header)
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path += "?" + cp.red.Query(raw)
+		}
+		in := &captureBuffer{max: cp.maxBytes}
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = &captureBody{ReadCloser: c.Request.Body, buf: in}
+		}
+		out := &captureWriter{ResponseWriter: c.Writer, buf: &captureBuffer{max: cp.maxBytes}}
+		c.Writer = out
+		start := time.Now()
+
+		c.Next()
+
+		cp.mu.Lock()
+		cp.captured++
+		cp.mu.Unlock()
+		reqBody, reqBytes, reqCut := in.snapshot()
+		respBody, respBytes, respCut := out.buf.snapshot()
+		cp.log.LogAttrs(c.Request.Context(), slog.LevelInfo, "capture",
+			slog.String("request_id", c.GetString("request_id")),
+			slog.String("reason", reason),
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", out.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Group("request",
+				slog.Any("headers", reqHeader),
+				slog.String("body", cp.body(reqBody, reqCut, c.Request.Header.Get("Content-Type"))),
+				slog.Int64("bytes", reqBytes),
+				slog.Bool("truncated", reqCut),
+			),
+			slog.Group("response",
+				slog.Any("headers", cp.red.Header(out.Header())),
+				slog.String("body", cp.body(respBody, respCut, out.Header().Get("Content-Type"))),
+				slog.Int64("bytes", respBytes),
+				slog.Bool("truncated", respCut),
+			),
+		)
+	}
+}
+
+// body — текст тела с маскированием; JSON — по полям, бинарное — только размер.
+func (cp *capturer) body(data []byte, truncated bool, contentType string) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if !utf8.Valid(data) && !truncated {
+		return "<binary>"
+	}
+	if strings.Contains(contentType, "json") || truncated && looksJSON(data) {
+		if truncated {
+			return string(cp.red.JSONPrefix(data))
+		}
+		return string(cp.red.JSON(data))
+	}
+	return cp.red.String(strings.ToValidUTF8(string(data), ""))
+}
+
+func looksJSON(data []byte) bool {
+	b := bytes.TrimLeft(data, " \t\r\n")
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[')
+}
+
+// captureBuffer — первые max байт и сколько было всего.
+type captureBuffer struct {
+	mu    sync.Mutex // тело может дочитываться хендлером после timeout'а
+	max   int
+	data  []byte
+	total int64
+}
+
+func (b *captureBuffer) add(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += int64(len(p))
+	if room := b.max - len(b.data); room > 0 {
+		b.data = append(b.data, p[:min(room, len(p))]...)
+	}
+}
+
+// snapshot — копия данных, всего байт и обрезано ли.
+func (b *captureBuffer) snapshot() ([]byte, int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.data...), b.total, b.total > int64(len(b.data))
+}
+
+type captureBody struct {
+	io.ReadCloser
+	buf *captureBuffer
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.add(p[:n])
+	return n, err
+}
+
+type captureWriter struct {
+	gin.ResponseWriter
+	buf *captureBuffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.buf.add(p[:n])
+	return n, err
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.buf.add([]byte(s[:n]))
+	return n, err
+}
+
+// Unwrap — для http.ResponseController (дедлайны чтения в limits).
+func (w *captureWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
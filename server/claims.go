@@ -0,0 +1,333 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ключи, под которыми мидлвары кладут клеймы в gin.Context
+const (
+	AccessClaimsKey  = "access_claims"
+	RefreshClaimsKey = "refresh_claims"
+)
+
+var ErrNoClaims = errors.New("no claims in context")
+
+// RegisteredClaims — стандартные клеймы (RFC 7519), удобно встраивать в свои структуры:
+//
+//	type MyClaims struct {
+//		server.RegisteredClaims
+//		Role string `json:"role"`
+//	}
+type RegisteredClaims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitzero"`
+	NotBefore NumericDate `json:"nbf,omitzero"`
+	IssuedAt  NumericDate `json:"iat,omitzero"`
+	ID        string      `json:"jti,omitempty"`
+	Scope     Scopes      `json:"scope,omitempty"`
+}
+
+// Audience — "aud" бывает строкой или массивом; всегда декодируем в список.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*a = stringList(v, false)
+	return nil
+}
+
+// Scopes — "scope" как строка через пробел (RFC 8693) или массив.
+type Scopes []string
+
+func (s *Scopes) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = stringList(v, true)
+	return nil
+}
+
+func (s Scopes) MarshalJSON() ([]byte, error) { return json.Marshal(strings.Join(s, " ")) }
+
+// Has — есть ли scope в списке.
+func (s Scopes) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericDate — время, которое понимает и unix‑секунды (JWT), и RFC3339 (PASETO).
+type NumericDate struct{ time.Time }
+
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	t, ok := toTime(v)
+	if !ok && v != nil {
+		return fmt.Errorf("invalid date: %s", b)
+	}
+	d.Time = t
+	return nil
+}
+
+func (d NumericDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.FormatInt(d.Unix(), 10)), nil
+}
+
+/* accessors на map‑клеймах */
+
+// GetString — строковый клейм ("" если нет или не строка).
+func (c Claims) GetString(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Time — клейм‑дата: unix‑секунды или RFC3339.
+func (c Claims) Time(key string) time.Time {
+	t, _ := toTime(c[key])
+	return t
+}
+
+func (c Claims) Subject() string      { return c.GetString("sub") }
+func (c Claims) Issuer() string       { return c.GetString("iss") }
+func (c Claims) ID() string           { return c.GetString("jti") }
+func (c Claims) ExpiresAt() time.Time { return c.Time("exp") }
+func (c Claims) NotBefore() time.Time { return c.Time("nbf") }
+func (c Claims) IssuedAt() time.Time  { return c.Time("iat") }
+func (c Claims) Audience() []string   { return stringList(c["aud"], false) }
+
+// Scopes — "scope" (строка через пробел или массив), с фолбэком на "scp".
+func (c Claims) Scopes() []string {
+	if v, ok := c["scope"]; ok {
+		return stringList(v, true)
+	}
+	return stringList(c["scp"], true)
+}
+
+// Decode — разложить клеймы в пользовательскую структуру (через JSON‑теги).
+func (c Claims) Decode(dst any) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// ToClaims — обратное преобразование: структура -> Claims.
+func ToClaims(v any) (Claims, error) {
+	if cl, ok := v.(Claims); ok {
+		return cl, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out Claims
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+/* доступ из хендлеров */
+
+// GetClaims — access‑клеймы текущего запроса.
+func GetClaims(c *gin.Context) (Claims, bool) { return claimsFrom(c, AccessClaimsKey) }
+
+// GetRefreshClaims — refresh‑клеймы текущего запроса.
+func GetRefreshClaims(c *gin.Context) (Claims, bool) { return claimsFrom(c, RefreshClaimsKey) }
+
+// ClaimsAs — access‑клеймы, декодированные в T. Результат кешируется на запрос,
+// поэтому повторные вызовы в мидлварах и хендлере не гоняют JSON заново.
+func ClaimsAs[T any](c *gin.Context) (T, error) { return typedClaims[T](c, AccessClaimsKey) }
+
+// RefreshClaimsAs — то же для refresh‑клеймов.
+func RefreshClaimsAs[T any](c *gin.Context) (T, error) { return typedClaims[T](c, RefreshClaimsKey) }
+
+// MustClaimsAs — как ClaimsAs, но паникует (RecoveryJSON вернёт 500).
+// Использовать только за AccessMiddleware.
+func MustClaimsAs[T any](c *gin.Context) T {
+	v, err := ClaimsAs[T](c)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Subject — "sub" из access‑клеймов ("" если нет).
+func Subject(c *gin.Context) string {
+	cl, _ := GetClaims(c)
+	return cl.Subject()
+}
+
+// MustSubject — "sub" из access‑клеймов; паникует, если его нет.
+func MustSubject(c *gin.Context) string {
+	sub := Subject(c)
+	if sub == "" {
+		panic(errors.New("access claims have no subject"))
+	}
+	return sub
+}
+
+func claimsFrom(c *gin.Context, key string) (Claims, bool) {
+	v, ok := c.Get(key)
+	if !ok {
+		return nil, false
+	}
+	switch cl := v.(type) {
+	case Claims:
+		return cl, true
+	case map[string]any:
+		return Claims(cl), true
+	}
+	return nil, false
+}
+
+func typedKey[T any](key string) string {
+	return key + ":" + reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+// dropTypedClaims — сбросить кеш типизированных клеймов key (клеймы подменены).
+func dropTypedClaims(c *gin.Context, key string) {
+	prefix := key + ":"
+	var drop []any
+	for k := range c.Keys {
+		if s, ok := k.(string); ok && strings.HasPrefix(s, prefix) {
+			drop = append(drop, k)
+		}
+	}
+	for _, k := range drop {
+		c.Delete(k)
+	}
+}
+
+func typedClaims[T any](c *gin.Context, key string) (T, error) {
+	var zero T
+	tk := typedKey[T](key)
+	if v, ok := c.Get(tk); ok {
+		if t, ok := v.(T); ok {
+			return t, nil
+		}
+	}
+	cl, ok := claimsFrom(c, key)
+	if !ok {
+		return zero, ErrNoClaims
+	}
+	var out T
+	if err := cl.Decode(&out); err != nil {
+		return zero, fmt.Errorf("decode claims: %w", err)
+	}
+	c.Set(tk, out)
+	return out, nil
+}
+
+/* типизированные валидаторы */
+
+// TypedValidator — адаптер: валидатор возвращает свою структуру T, а наружу
+// это выглядит как обычный TokenValidator. Типизированное значение сразу
+// кладётся в кеш, так что ClaimsAs[T] не делает лишнего декодирования.
+type TypedValidator[T any] struct {
+	Access  func(c *gin.Context, token string) (T, error)
+	Refresh func(c *gin.Context, token string) (T, error)
+}
+
+func (v TypedValidator[T]) ValidateAccess(c *gin.Context, tok string) (Claims, error) {
+	return validateTyped(c, tok, v.Access, AccessClaimsKey)
+}
+
+func (v TypedValidator[T]) ValidateRefresh(c *gin.Context, tok string) (Claims, error) {
+	return validateTyped(c, tok, v.Refresh, RefreshClaimsKey)
+}
+
+func validateTyped[T any](c *gin.Context, tok string, f func(*gin.Context, string) (T, error), key string) (Claims, error) {
+	if f == nil {
+		return nil, errors.New("validator not configured")
+	}
+	t, err := f(c, tok)
+	if err != nil {
+		return nil, err
+	}
+	cl, err := ToClaims(t)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(typedKey[T](key), t)
+	return cl, nil
+}
+
+/* helpers */
+
+func toTime(v any) (time.Time, bool) {
+	switch x := v.(type) {
+	case float64:
+		sec, frac := math.Modf(x)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	case int64:
+		return time.Unix(x, 0), true
+	case int:
+		return time.Unix(int64(x), 0), true
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return time.Unix(n, 0), true
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339, x); err == nil {
+			return t, true
+		}
+		if n, err := strconv.ParseInt(x, 10, 64); err == nil {
+			return time.Unix(n, 0), true
+		}
+	case time.Time:
+		return x, true
+	}
+	return time.Time{}, false
+}
+
+func stringList(v any, splitSpaces bool) []string {
+	switch x := v.(type) {
+	case string:
+		if splitSpaces {
+			return strings.Fields(x)
+		}
+		if x == "" {
+			return nil
+		}
+		return []string{x}
+	case []string:
+		return x
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, e := range x {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Алгоритмы ConcurrencyConfig.Algorithm.
+const (
+	ConcurrencyFixed    = "fixed"
+	ConcurrencyAIMD     = "aimd"
+	ConcurrencyGradient = "gradient"
+)
+
+// Priority — приоритет роута при перегрузке.
+type Priority int
+
+const (
+	PriorityLow      Priority = iota - 1 // при полном лимите — сразу 503, без очереди
+	PriorityNormal                       // ждёт в очереди
+	PriorityHigh                         // ждёт в очереди впереди normal
+	PriorityCritical                     // не ограничивается и не отбрасывается
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// concurrencyLimiter — лимит одновременных запросов с очередью и адаптацией
+// лимита по задержкам (AIMD или gradient).
+type concurrencyLimiter struct {
+	cfg        ConcurrencyConfig
+	priorities routeTable[Priority]
+	basePath   string
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	queue    [2][]*concurrencyWaiter // [0] — normal, [1] — high
+	longRTT  float64                 // gradient: EMA задержки, секунды
+
+	shed     atomic.Int64
+	timedOut atomic.Int64 // отброшены после ожидания в очереди
+}
+
+type concurrencyWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newConcurrencyLimiter(cfg ConcurrencyConfig, basePath string) (*concurrencyLimiter, error) {
+	switch cfg.Algorithm {
+	case ConcurrencyFixed, ConcurrencyAIMD, ConcurrencyGradient:
+	default:
+		return nil, fmt.Errorf("concurrency: unknown algorithm %q", cfg.Algorithm)
+	}
+	if cfg.Limit <= 0 {
+		cfg.Limit = 100
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 1000
+	}
+	if cfg.MinLimit > cfg.MaxLimit {
+		return nil, fmt.Errorf("concurrency: MinLimit %d > MaxLimit %d", cfg.MinLimit, cfg.MaxLimit)
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.9
+	}
+	if cfg.Algorithm == ConcurrencyAIMD && cfg.LatencyThreshold <= 0 {
+		return nil, errors.New("concurrency: aimd needs LatencyThreshold")
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	if cfg.MaxWait > 0 && cfg.QueueSize <= 0 {
+		// иначе очередь нулевой длины отбрасывала бы всё сверх лимита
+		cfg.QueueSize = cfg.Limit
+	}
+	return &concurrencyLimiter{
+		cfg:        cfg,
+		priorities: newRouteTable(cfg.Priorities),
+		basePath:   strings.TrimRight(basePath, "/"),
+		limit:      float64(cfg.Limit),
+	}, nil
+}
+
+func (l *concurrencyLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prio := l.priority(c)
+		if prio >= PriorityCritical {
+			c.Next()
+			return
+		}
+		if !l.acquire(c.Request.Context(), prio) {
+			l.shed.Add(1)
+			c.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(l.cfg.RetryAfter))))
+			RespondError(c, http.StatusServiceUnavailable, "overloaded", "server is overloaded, retry later", nil)
+			return
+		}
+		start := time.Now()
+		defer func() {
+			l.release(time.Since(start), c.Writer.Status() >= http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+func (l *concurrencyLimiter) priority(c *gin.Context) Priority {
+	if systemPath(l.basePath, c.Request.URL.Path) {
+		return PriorityCritical
+	}
+	if p, ok := l.priorities.lookup(c.Request.Method, c.FullPath()); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// acquire — занять слот; при полном лимите — очередь (кроме low) не дольше MaxWait.
+func (l *concurrencyLimiter) acquire(ctx context.Context, prio Priority) bool {
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && l.queuedLocked(prio) == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return true
+	}
+	if prio <= PriorityLow || l.cfg.MaxWait <= 0 || l.queuedLocked(PriorityNormal) >= l.cfg.QueueSize {
+		l.mu.Unlock()
+		return false
+	}
+	w := &concurrencyWaiter{ready: make(chan struct{})}
+	q := queueIndex(prio)
+	l.queue[q] = append(l.queue[q], w)
+	l.mu.Unlock()
+
+	t := time.NewTimer(l.cfg.MaxWait)
+	defer t.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted { // слот выдали одновременно с таймаутом
+		return true
+	}
+	for i, x := range l.queue[q] {
+		if x == w {
+			l.queue[q] = append(l.queue[q][:i], l.queue[q][i+1:]...)
+			break
+		}
+	}
+	l.timedOut.Add(1)
+	return false
+}
+
+// queuedLocked — сколько ждут с приоритетом не ниже prio.
+func (l *concurrencyLimiter) queuedLocked(prio Priority) int {
+	n := len(l.queue[1])
+	if prio <= PriorityNormal {
+		n += len(l.queue[0])
+	}
+	return n
+}
+
+func queueIndex(p Priority) int {
+	if p >= PriorityHigh {
+		return 1
+	}
+	return 0
+}
+
+func (l *concurrencyLimiter) release(rtt time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	l.adaptLocked(rtt, dropped)
+	for l.inflight < int(l.limit) {
+		var w *concurrencyWaiter
+		for q := len(l.queue) - 1; q >= 0 && w == nil; q-- {
+			if len(l.queue[q]) > 0 {
+				w, l.queue[q] = l.queue[q][0], l.queue[q][1:]
+			}
+		}
+		if w == nil {
+			break
+		}
+		l.inflight++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// adaptLocked — новый лимит по результату запроса.
+func (l *concurrencyLimiter) adaptLocked(rtt time.Duration, dropped bool) {
+	switch l.cfg.Algorithm {
+	case ConcurrencyAIMD:
+		// уменьшаем мультипликативно; растём на 1/limit за запрос — примерно +1
+		// за limit завершений, и только когда лимит реально используется
+		if dropped || rtt > l.cfg.LatencyThreshold {
+			l.limit *= l.cfg.Backoff
+		} else if float64(l.inflight+1)*2 >= l.limit {
+			l.limit += 1 / l.limit
+		}
+	case ConcurrencyGradient:
+		// gradient = долгая задержка / текущая: растущая задержка прижимает лимит,
+		// sqrt(limit) — запас на очередь, чтобы лимит мог расти
+		sample := rtt.Seconds()
+		if l.longRTT == 0 {
+			l.longRTT = sample
+		}
+		l.longRTT = l.longRTT*0.99 + sample*0.01
+		gradient := 1.0
+		if sample > 0 {
+			gradient = math.Max(0.5, math.Min(1, l.longRTT/sample))
+		}
+		if dropped {
+			gradient = 0.5
+		}
+		next := l.limit*gradient + math.Sqrt(l.limit)
+		if float64(l.inflight+1)*2 < l.limit {
+			next = math.Min(next, l.limit) // лимит не используется — не растём
+		}
+		l.limit = l.limit*0.8 + next*0.2
+	default:
+		return
+	}
+	l.limit = math.Max(float64(l.cfg.MinLimit), math.Min(float64(l.cfg.MaxLimit), l.limit))
+}
+
+// Stats — для /sys/concurrency.
+func (l *concurrencyLimiter) Stats() gin.H {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return gin.H{
+		"algorithm":      l.cfg.Algorithm,
+		"limit":          int(l.limit),
+		"min_limit":      l.cfg.MinLimit,
+		"max_limit":      l.cfg.MaxLimit,
+		"inflight":       l.inflight,
+		"queued":         len(l.queue[0]) + len(l.queue[1]),
+		"queue_size":     l.cfg.QueueSize,
+		"max_wait":       l.cfg.MaxWait.String(),
+		"shed_total":     l.shed.Load(),
+		"queue_timeouts": l.timedOut.Load(),
+	}
+}
@@ -1,14 +1,40 @@
 package server
 
-import "time"
+import (
+	"context"
+	"crypto/ed25519"
+	"log/slog"
+	"time"
+)
 
 type CORSConfig struct {
-	AllowedOrigins   []string
+	// точные origin'ы, "*", "https://*.example.com", "http://localhost:*"
+	AllowedOrigins []string
+	// регулярки по origin'у целиком, например `https://[a-z0-9-]+\.example\.com`
+	AllowedOriginPatterns []string
+	// динамическая проверка (например, DynamicOrigins.Allow) — после статических списков
+	AllowOriginFunc  func(ctx context.Context, origin string) bool
 	AllowedMethods   []string
 	AllowedHeaders   []string
 	ExposedHeaders   []string
 	AllowCredentials bool
 	MaxAge           time.Duration
+	// строгий режим: preflight проверяется по Access-Control-Request-Method/-Headers,
+	// отражаются только разрешённые заголовки, OPTIONS без preflight‑заголовков
+	// уходят в роуты
+	Strict bool
+	// статус ответа на preflight (по умолчанию 204; 200 — для старых клиентов)
+	PreflightStatus int
+	// Private Network Access: отвечать Access-Control-Allow-Private-Network
+	AllowPrivateNetwork bool
+	// Timing-Allow-Origin: "*" или origin'ы, которым видны Resource Timing детали
+	TimingAllowOrigins []string
+	// изоляция: Cross-Origin-Resource-Policy ("same-origin" | "same-site" | "cross-origin"),
+	// Cross-Origin-Opener-Policy ("same-origin" | "same-origin-allow-popups" | "unsafe-none"),
+	// Cross-Origin-Embedder-Policy ("require-corp" | "credentialless" | "unsafe-none")
+	ResourcePolicy string
+	OpenerPolicy   string
+	EmbedderPolicy string
 }
 
 type HTTPTimeouts struct {
@@ -21,8 +47,60 @@ type HTTPTimeouts struct {
 type LogConfig struct {
 	AccessFile         string
 	ErrorFile          string
-	RotateMaxSizeBytes int64 // 0 — без ротации
-	RotateBackups      int
+	RotateMaxSizeBytes int64 // 0 — без ротации по размеру
+	RotateBackups      int   // сколько бэкапов хранить; 0 — все
+	// ротация по времени: RotateHourly, RotateDaily; пусто — только по размеру
+	RotateEvery string
+	// удалять бэкапы старше; 0 — не удалять по возрасту
+	RotateMaxAge time.Duration
+	// сжатие бэкапов в фоне: "gzip", "zstd" или зарегистрированный RegisterLogCompressor
+	RotateCompress string
+	// журнал аудита — всегда отдельный файл (своя ротация и хранение);
+	// пусто и без AuditSinks — аудит выключен (server.Audit -> ErrAuditUnavailable)
+	AuditFile string
+	// дополнительные получатели (syslog, journald, stdout…) — к файлу или вместо него:
+	// при пустом AccessFile/ErrorFile и заданных sinks stdout/stderr не используется
+	AccessSinks []LogSink
+	ErrorSinks  []LogSink
+	AuditSinks  []LogSink
+	// access‑лог: LogFormatJSON (по умолчанию) или LogFormatLogfmt
+	AccessFormat string
+	// какие поля писать (AccessField*); пусто — все
+	AccessFields []string
+	// лог сервера (ErrorFile): формат как у AccessFormat и минимальный уровень
+	ErrorFormat string
+	Level       slog.Level
+	// уровни модулей (LogModule*), иначе — Level; меняются через PUT /sys/log/level
+	ModuleLevels map[string]slog.Level
+	// сэмплирование access‑лога; меняется через PUT /sys/log/sampling
+	AccessSampling []AccessSampleRule
+	// маскирование секретов во всех логах (access, ошибки, паники, server.Logger(c))
+	Redact RedactConfig
+	// журнал аудита (AuditFile) с hash‑цепочкой
+	Audit AuditConfig
+}
+
+// AuditConfig — подписанные checkpoint'ы журнала аудита (см. VerifyAuditFile).
+// Без SigningKey пишется только hash‑цепочка.
+type AuditConfig struct {
+	SigningKey ed25519.PrivateKey
+	// checkpoint каждые N записей (по умолчанию 1000) и/или раз в интервал
+	// (только с SigningKey); и при запуске и остановке
+	CheckpointEvery    int
+	CheckpointInterval time.Duration
+}
+
+// RedactConfig — что маскировать в логах. По умолчанию: Authorization, Cookie,
+// X-API-Key и заголовки/cookies из AuthConfig и RateLimitConfig, а также
+// access_token, refresh_token, password, client_secret и т.п. в query и JSON.
+type RedactConfig struct {
+	Headers []string // имена заголовков (без учёта регистра)
+	Cookies []string
+	Query   []string // query‑параметры
+	Fields  []string // поля JSON (на любой глубине) и ключи записей slog
+	Mask    string   // по умолчанию RedactMask
+	// только перечисленное выше, без списков по умолчанию
+	DisableDefaults bool
 }
 
 type AuthConfig struct {
@@ -34,6 +112,12 @@ type AuthConfig struct {
 	// включение стандартных мидлваров
 	EnableAccessMiddleware  bool
 	EnableRefreshMiddleware bool
+	// impersonation: заголовок с subject'ом клиента ("X-Act-As"); пусто — выключено
+	ImpersonationHeader string
+	// право в scope/permissions actor'а, по умолчанию "impersonate"
+	ImpersonationPermission string
+	// право для управляющих /sys‑эндпоинтов (/sys/logs/reopen), по умолчанию "sys:admin"
+	SysAdminPermission string
 }
 
 type TimeoutConfig struct {
@@ -42,6 +126,129 @@ type TimeoutConfig struct {
 	RequestTimeout time.Duration
 	// что возвращать, если сработал timeout
 	GatewayTimeoutStatus int // по умолчанию 504
+	// переопределения по роутам: "GET /api/v1/reports/export", "/api/v1/pricing/*"
+	// (группа); TimeoutDisabled — без timeout'а. В коде — Routes.Timeout/RouteTimeout (WithRoutes).
+	Routes map[string]time.Duration
+	// бюджет от upstream'а: заголовок (RequestTimeoutHeader — "1.5s"/"1500" мс,
+	// или GRPCTimeoutHeader — "1500m"); пусто — не читаем. Эффективный timeout —
+	// меньшее из бюджета (зажатого в [ClientTimeoutMin, ClientTimeoutMax]) и серверного;
+	// бюджет 0 — как без заголовка.
+	ClientDeadlineHeader string
+	ClientTimeoutMin     time.Duration
+	ClientTimeoutMax     time.Duration // 0 — без верхней границы
+}
+
+type LimitsConfig struct {
+	// максимальный размер тела запроса; 0 — без лимита
+	MaxBodyBytes int64
+	// переопределения по роутам (ключи как в TimeoutConfig.Routes);
+	// BodyUnlimited — без лимита. В коде — Routes.BodyLimit/RouteBodyLimit (WithRoutes).
+	Routes map[string]int64
+	// максимум полей заголовка в запросе (431); 0 — без лимита
+	MaxHeaderCount int
+	// минимальная скорость чтения тела, байт/с (408); 0 — выключено.
+	// Для тела заменяет дедлайн чтения HTTPTimeouts.ReadTimeout.
+	MinBodyRate int64
+	// сколько медленный клиент терпим в начале тела, по умолчанию 5s
+	MinBodyRateGrace time.Duration
+}
+
+type RateLimitConfig struct {
+	// правила проверяются все; запрос проходит, только если пускают все
+	Rules []RateLimitRule
+	// не отдавать RateLimit-* заголовки (Retry-After на 429 отдаётся всегда)
+	DisableHeaders bool
+	// шардов in-memory хранилища, по умолчанию 64
+	Shards int
+}
+
+type RateLimitRule struct {
+	// имя в RateLimit-Policy и ключах хранилища; по умолчанию "rule<N>"
+	Name string
+	// из чего ключ: RateByIP, RateBySubject, RateByAPIKey, RateByRoute, RateByTenant
+	// (можно несколько: {RateBySubject, RateByRoute} — лимит на пользователя в роуте)
+	By []RateLimitKey
+	// RateTokenBucket (по умолчанию) или RateSlidingWindow
+	Algorithm string
+	// Limit запросов за Window; Burst — ёмкость корзины token bucket (по умолчанию Limit)
+	Limit  int
+	Window time.Duration
+	Burst  int
+	// к каким роутам применять (ключи как в TimeoutConfig.Routes); пусто — ко всем
+	Routes []string
+	// заголовок с API‑ключом для RateByAPIKey, по умолчанию "X-API-Key"
+	APIKeyHeader string
+}
+
+type ConcurrencyConfig struct {
+	// ConcurrencyFixed, ConcurrencyAIMD, ConcurrencyGradient; пусто — выключено
+	Algorithm string
+	// стартовый (для fixed — постоянный) лимит одновременных запросов, по умолчанию 100
+	Limit int
+	// границы адаптивного лимита, по умолчанию 1..1000
+	MinLimit, MaxLimit int
+	// AIMD: запрос медленнее порога (или 5xx/timeout) — лимит умножается на Backoff (0.9)
+	LatencyThreshold time.Duration
+	Backoff          float64
+	// очередь сверх лимита: сколько ждут и как долго; MaxWait 0 — без очереди,
+	// QueueSize 0 при MaxWait > 0 — по Limit
+	QueueSize int
+	MaxWait   time.Duration
+	// приоритеты роутов (ключи как в TimeoutConfig.Routes); по умолчанию PriorityNormal.
+	// /sys/* и health‑пробы — всегда PriorityCritical.
+	Priorities map[string]Priority
+	// Retry-After для 503, по умолчанию 1s
+	RetryAfter time.Duration
+}
+
+// CaptureConfig — отладочный захват тел запросов/ответов (с маскированием LogConfig.Redact).
+// Какие запросы пишутся: с заголовком TriggerHeader, доля SampleRate (или Routes),
+// либо включённые на время через PUT /sys/capture.
+type CaptureConfig struct {
+	// файл capture‑лога (ротация — как у остальных логов); пусто — выключено
+	File string
+	// сколько байт каждого тела писать, по умолчанию 64 KiB
+	MaxBodyBytes int
+	// доля запросов 0..1; 0 — только по заголовку или /sys/capture
+	SampleRate float64
+	// доля по роутам (ключи как в TimeoutConfig.Routes) — вместо SampleRate
+	Routes map[string]float64
+	// заголовок‑триггер ("X-Debug-Capture"); TriggerValue — если задан, значение должно совпасть
+	TriggerHeader string
+	TriggerValue  string
+}
+
+type TenantConfig struct {
+	// источники tenant'а (пустые — не используются); найденные обязаны совпадать
+	HostSuffix string // "example.com": acme.example.com -> acme
+	Header     string // например, "X-Tenant-Id"
+	PathPrefix bool   // BasePath/{tenant}/... (нужен BasePath и Tenants или Known)
+	Claim      string // клейм в access_claims, например "tenant"
+	// без tenant'а — 400
+	Required bool
+	// настройки по tenant'ам (id без учёта регистра); KnownOnly — остальные получают 404
+	Tenants   map[string]TenantSettings
+	KnownOnly bool
+	// динамический список tenant'ов (например, из БД) в дополнение к Tenants;
+	// получает id в нижнем регистре, вызывается на каждый запрос
+	Known func(id string) bool
+}
+
+type TenantSettings struct {
+	AllowedOrigins []string // добавляются к CORS.AllowedOrigins
+	RateLimit      float64  // запросов в секунду на tenant (через LimiterStore); 0 — без лимита
+	RateBurst      int      // по умолчанию ceil(RateLimit)
+}
+
+type KeyringConfig struct {
+	Alg           string        // "EdDSA" (по умолчанию, годится и для PASETO v4) | "ES256"
+	RotateEvery   time.Duration // 0 — без авто‑ротации
+	RetainRetired time.Duration // сколько публиковать retired (>= TTL токенов); по умолчанию RotateEvery
+	JWKSPath      string        // по умолчанию "/.well-known/jwks.json"
+	PASERKPath    string        // по умолчанию "/.well-known/paserk.json"
+	// где хранить ключи (NewFileKeySource или своя реализация); nil — только в памяти:
+	// после перезапуска и на каждой реплике — свой JWKS
+	Source KeySource
 }
 
 type Config struct {
@@ -49,11 +256,18 @@ type Config struct {
 	Release  bool
 	BasePath string
 
-	CORS       CORSConfig
-	Timeouts   HTTPTimeouts
-	Log        LogConfig
-	Auth       AuthConfig
-	PerRequest TimeoutConfig
+	CORS CORSConfig
+	// именованные политики для групп/роутов (Routes.CORSPolicy, Routes.RouteCORSPolicy)
+	CORSPolicies map[string]CORSConfig
+	Timeouts     HTTPTimeouts
+	Log          LogConfig
+	Auth         AuthConfig
+	PerRequest   TimeoutConfig
+	Tenant       TenantConfig
+	Limits       LimitsConfig
+	RateLimit    RateLimitConfig
+	Concurrency  ConcurrencyConfig
+	Capture      CaptureConfig
 
 	ShutdownWait time.Duration
 	// печатать таблицу роутов при старте
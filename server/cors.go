@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -8,75 +9,245 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
-	origins := normalize(cfg.AllowedOrigins)
-	methods := strings.Join(unique(upperAll(defaultIfEmpty(cfg.AllowedMethods,
-		[]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}))), ", ")
-	headers := strings.Join(unique(headerCaseAll(defaultIfEmpty(cfg.AllowedHeaders,
-		[]string{"Content-Type", "Authorization", "X-Requested-With"}))), ", ")
-	exposed := strings.Join(unique(headerCaseAll(cfg.ExposedHeaders)), ", ")
-	maxAge := ""
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc { return corsMiddleware(cfg, nil) }
+
+// corsMiddleware — то же, плюс origin'ы tenant'а запроса (если tenants != nil).
+func corsMiddleware(cfg CORSConfig, tn *tenants) gin.HandlerFunc {
+	p := newCORSPolicy(cfg)
+	return func(c *gin.Context) { p.handle(c, tn.originsFor(c)) }
+}
+
+// originAllowed — статический список, origin'ы tenant'а, затем AllowOriginFunc.
+func (p *corsPolicy) originAllowed(c *gin.Context, origin string, extra *originMatcher) bool {
+	if origin == "" {
+		return false
+	}
+	canon := requestOrigin(origin)
+	if p.origins.match(canon) || extra.match(canon) {
+		return true
+	}
+	return p.cfg.AllowOriginFunc != nil && p.cfg.AllowOriginFunc(c.Request.Context(), origin)
+}
+
+// corsPolicy — CORSConfig, разобранный один раз при старте.
+type corsPolicy struct {
+	cfg        CORSConfig
+	origins    *originMatcher
+	methods    map[string]struct{}
+	methodsHdr string
+	headers    map[string]struct{} // в нижнем регистре
+	headersHdr string
+	anyHeader  bool
+	exposed    string
+	maxAge     string
+	preflight  int
+	timing     *originMatcher
+}
+
+func newCORSPolicy(cfg CORSConfig) *corsPolicy {
+	origins, _ := normalizeOrigins(cfg.AllowedOrigins)
+	// битые регулярки отсекает ValidateCORS при старте; здесь пропускаем молча
+	var patterns []string
+	for _, pat := range cfg.AllowedOriginPatterns {
+		if _, err := compileOriginPattern(pat); err == nil {
+			patterns = append(patterns, pat)
+		}
+	}
+	m, _ := compileOrigins(origins, patterns)
+	p := &corsPolicy{cfg: cfg, origins: m}
+
+	methods := unique(upperAll(defaultIfEmpty(cfg.AllowedMethods,
+		[]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})))
+	p.methods = make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		p.methods[m] = struct{}{}
+	}
+	p.methodsHdr = strings.Join(methods, ", ")
+
+	headers := unique(headerCaseAll(defaultIfEmpty(cfg.AllowedHeaders,
+		[]string{"Content-Type", "Authorization", "X-Requested-With"})))
+	p.headers = make(map[string]struct{}, len(headers))
+	for _, h := range headers {
+		if h == "*" {
+			// "*" для заголовков не работает вместе с credentials (Fetch spec)
+			p.anyHeader = !cfg.AllowCredentials
+			continue
+		}
+		p.headers[strings.ToLower(h)] = struct{}{}
+	}
+	p.headersHdr = strings.Join(headers, ", ")
+
+	p.exposed = strings.Join(unique(headerCaseAll(cfg.ExposedHeaders)), ", ")
 	if cfg.MaxAge > 0 {
-		maxAge = strconvI(int(cfg.MaxAge / time.Second))
+		p.maxAge = strconvI(int(cfg.MaxAge / time.Second))
+	}
+	p.preflight = cfg.PreflightStatus
+	if p.preflight == 0 {
+		p.preflight = http.StatusNoContent
+	}
+	if len(cfg.TimingAllowOrigins) > 0 {
+		timing, _ := normalizeOrigins(cfg.TimingAllowOrigins)
+		p.timing, _ = compileOrigins(timing, nil)
 	}
+	return p
+}
 
-	return func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-		if originAllowed(origin, origins) {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", allowValue(origin, origins))
-			if cfg.AllowCredentials {
-				c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-			}
-			if exposed != "" {
-				c.Writer.Header().Set("Access-Control-Expose-Headers", exposed)
-			}
+// isolationHeaders — CORP/COOP/COEP и Timing-Allow-Origin на обычных ответах.
+func (p *corsPolicy) isolationHeaders(h http.Header, origin string) {
+	if v := p.cfg.ResourcePolicy; v != "" {
+		h.Set("Cross-Origin-Resource-Policy", v)
+	}
+	if v := p.cfg.OpenerPolicy; v != "" {
+		h.Set("Cross-Origin-Opener-Policy", v)
+	}
+	if v := p.cfg.EmbedderPolicy; v != "" {
+		h.Set("Cross-Origin-Embedder-Policy", v)
+	}
+	switch {
+	case p.timing == nil:
+	case p.timing.any:
+		h.Set("Timing-Allow-Origin", "*")
+	case p.timing.match(requestOrigin(origin)):
+		h.Set("Timing-Allow-Origin", origin)
+	}
+}
+
+func (p *corsPolicy) handle(c *gin.Context, extra *originMatcher) {
+	h := c.Writer.Header()
+	origin := c.Request.Header.Get("Origin")
+	allowValue := origin
+	if p.origins.any {
+		allowValue = "*"
+	} else {
+		// ответ зависит от Origin — кэши обязаны это учитывать
+		h.Add("Vary", "Origin")
+	}
+
+	okOrigin := p.originAllowed(c, origin, extra)
+	if okOrigin {
+		h.Set("Access-Control-Allow-Origin", allowValue)
+		if p.cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
 		}
-		if c.Request.Method == http.MethodOptions {
-			if methods != "" {
-				c.Writer.Header().Set("Access-Control-Allow-Methods", methods)
-			}
-			if headers != "" {
-				c.Writer.Header().Set("Access-Control-Allow-Headers", headers)
-			}
-			if maxAge != "" {
-				c.Writer.Header().Set("Access-Control-Max-Age", maxAge)
-			}
-			c.AbortWithStatus(http.StatusNoContent)
-			return
+		if p.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", p.exposed)
 		}
+	}
+
+	if c.Request.Method != http.MethodOptions {
+		p.isolationHeaders(h, origin)
 		c.Next()
+		return
+	}
+	pna := strings.EqualFold(c.Request.Header.Get("Access-Control-Request-Private-Network"), "true")
+	if !p.cfg.Strict {
+		if pna && p.cfg.AllowPrivateNetwork && okOrigin {
+			h.Set("Access-Control-Allow-Private-Network", "true")
+		}
+		if p.methodsHdr != "" {
+			h.Set("Access-Control-Allow-Methods", p.methodsHdr)
+		}
+		if p.headersHdr != "" {
+			h.Set("Access-Control-Allow-Headers", p.headersHdr)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(p.preflight)
+		return
 	}
-}
 
-func originAllowed(origin string, allowed []string) bool {
-	if origin == "" || len(allowed) == 0 {
-		return false
+	// strict: preflight — только OPTIONS с Origin и Access-Control-Request-Method,
+	// остальные OPTIONS уходят в обычные роуты
+	reqMethod := c.Request.Header.Get("Access-Control-Request-Method")
+	if origin == "" || reqMethod == "" {
+		p.isolationHeaders(h, origin)
+		c.Next()
+		return
+	}
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if p.cfg.AllowPrivateNetwork {
+		h.Add("Vary", "Access-Control-Request-Private-Network")
+	}
+
+	if !okOrigin {
+		p.reject(c, "origin %q not allowed", origin)
+		return
+	}
+	if !p.methodAllowed(reqMethod) {
+		p.reject(c, "method %q not allowed for origin %q", reqMethod, origin)
+		return
 	}
-	for _, a := range allowed {
-		if a == "*" || strings.EqualFold(a, origin) {
-			return true
+	reqHeaders := parseHeaderList(c.Request.Header.Get("Access-Control-Request-Headers"))
+	for _, rh := range reqHeaders {
+		if !p.headerAllowed(rh) {
+			p.reject(c, "header %q not allowed for origin %q", rh, origin)
+			return
 		}
-		if strings.HasPrefix(a, "http://*.") || strings.HasPrefix(a, "https://*.") {
-			prefix := "://*."
-			if i := strings.Index(a, prefix); i > 0 {
-				scheme := a[:i]
-				domain := a[i+len(prefix):]
-				if strings.HasPrefix(strings.ToLower(origin), scheme+"://") &&
-					strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(domain)) {
-					return true
-				}
-			}
+	}
+	if pna {
+		if !p.cfg.AllowPrivateNetwork {
+			p.reject(c, "private network access not allowed for origin %q", origin)
+			return
 		}
+		h.Set("Access-Control-Allow-Private-Network", "true")
+	}
+
+	h.Set("Access-Control-Allow-Methods", reqMethod)
+	if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headerCaseAll(reqHeaders), ", "))
+	}
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
 	}
-	return false
+	c.AbortWithStatus(p.preflight)
 }
-func allowValue(origin string, allowed []string) string {
-	for _, a := range allowed {
-		if a == "*" {
-			return "*"
+
+// reject — отказ в preflight; причина уходит в error log через ErrorCapture.
+func (p *corsPolicy) reject(c *gin.Context, format string, args ...any) {
+	err := fmt.Errorf("cors preflight rejected: "+format, args...)
+	Logger(c).Debug(err.Error(), "module", LogModuleCORS, "origin", c.GetHeader("Origin"))
+	_ = c.Error(err)
+	h := c.Writer.Header()
+	h.Del("Access-Control-Allow-Origin")
+	h.Del("Access-Control-Allow-Credentials")
+	h.Del("Access-Control-Expose-Headers")
+	RespondError(c, http.StatusForbidden, "cors_rejected", "cors preflight rejected", nil)
+}
+
+// methodAllowed — safelisted методы (GET/HEAD/POST) разрешены всегда.
+func (p *corsPolicy) methodAllowed(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		return true
+	}
+	_, ok := p.methods[m]
+	return ok
+}
+
+// headerAllowed — safelisted заголовки (Fetch spec) разрешены всегда.
+func (p *corsPolicy) headerAllowed(name string) bool {
+	switch name {
+	case "accept", "accept-language", "content-language":
+		return true
+	}
+	if p.anyHeader && name != "authorization" {
+		return true
+	}
+	_, ok := p.headers[name]
+	return ok
+}
+
+// parseHeaderList — "X-A, x-b" -> ["x-a", "x-b"].
+func parseHeaderList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if s := strings.ToLower(strings.TrimSpace(part)); s != "" {
+			out = append(out, s)
 		}
 	}
-	return origin
+	return out
 }
 
 /* helpers */
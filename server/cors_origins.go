@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// originMatcher — скомпилированный список разрешённых origin'ов:
+// точные, "scheme://*.domain", "scheme://host:*" и регулярки.
+type originMatcher struct {
+	any     bool
+	exact   map[string]struct{}
+	subs    []originPattern
+	ports   []originPattern
+	regexps []*regexp.Regexp
+}
+
+type originPattern struct{ scheme, host string }
+
+// compileOrigins — origins должны быть уже нормализованы (canonicalOrigin);
+// регулярки якорятся целиком: "https://[a-z]+\.example\.com" == ^(?:...)$.
+func compileOrigins(origins, patterns []string) (*originMatcher, error) {
+	m := &originMatcher{exact: map[string]struct{}{}}
+	for _, o := range origins {
+		switch {
+		case o == "*":
+			m.any = true
+		case strings.Contains(o, "://*."):
+			scheme, host, _ := strings.Cut(o, "://*.")
+			m.subs = append(m.subs, originPattern{scheme, host})
+		case strings.HasSuffix(o, ":*"):
+			scheme, host, _ := strings.Cut(strings.TrimSuffix(o, ":*"), "://")
+			m.ports = append(m.ports, originPattern{scheme, host})
+		default:
+			m.exact[o] = struct{}{}
+		}
+	}
+	for _, p := range patterns {
+		re, err := compileOriginPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		m.regexps = append(m.regexps, re)
+	}
+	return m, nil
+}
+
+func compileOriginPattern(p string) (*regexp.Regexp, error) {
+	p = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(p), "^"), "$")
+	re, err := regexp.Compile(`^(?:` + p + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("cors: origin pattern %q: %w", p, err)
+	}
+	return re, nil
+}
+
+// match — origin в канонической форме (requestOrigin).
+func (m *originMatcher) match(origin string) bool {
+	if m == nil || origin == "" {
+		return false
+	}
+	if m.any {
+		return true
+	}
+	if _, ok := m.exact[origin]; ok {
+		return true
+	}
+	scheme, hostport, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	for _, p := range m.subs {
+		if p.scheme == scheme && strings.HasSuffix(hostport, "."+p.host) {
+			return true
+		}
+	}
+	for _, p := range m.ports {
+		if p.scheme == scheme && strings.Trim(p.host, "[]") == strings.Trim(host, "[]") {
+			return true
+		}
+	}
+	for _, re := range m.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+/* динамические origin'ы */
+
+func anyOriginFunc(fs ...func(context.Context, string) bool) func(context.Context, string) bool {
+	return func(ctx context.Context, origin string) bool {
+		for _, f := range fs {
+			if f != nil && f(ctx, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// OriginLoader — источник списка origin'ов (файл, БД, конфиг‑сервис...).
+type OriginLoader func(ctx context.Context) ([]string, error)
+
+// FileOriginLoader — один origin на строку (# — комментарий) или JSON‑массив.
+func FileOriginLoader(path string) OriginLoader {
+	return func(context.Context) ([]string, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '[' {
+			var out []string
+			if err := json.Unmarshal(t, &out); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return out, nil
+		}
+		var out []string
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			line, _, _ := strings.Cut(sc.Text(), "#")
+			if line = strings.TrimSpace(line); line != "" {
+				out = append(out, line)
+			}
+		}
+		return out, sc.Err()
+	}
+}
+
+// DynamicOrigins — перезагружаемый список origin'ов; Allow подходит как
+// CORSConfig.AllowOriginFunc. Новые front‑end origin'ы tenant'ов
+// подхватываются без рестарта (по таймеру или ручным Reload).
+type DynamicOrigins struct {
+	load       OriginLoader
+	every      time.Duration
+	cur        atomic.Pointer[originMatcher]
+	noWildcard atomic.Bool // политика с AllowCredentials: "*" не принимается
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewDynamicOrigins — первая загрузка синхронная: битый источник или строка = ошибка старта.
+func NewDynamicOrigins(load OriginLoader, every time.Duration) (*DynamicOrigins, error) {
+	d := &DynamicOrigins{load: load, every: every, stop: make(chan struct{})}
+	if err := d.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload — перечитать источник. Если источник недоступен, остаётся предыдущий список;
+// битые строки пропускаются (остальные применяются) и возвращаются в ошибке.
+// Строки вида "re:<regexp>" — регулярки, остальные — обычные origin'ы.
+func (d *DynamicOrigins) Reload(ctx context.Context) error {
+	list, err := d.load(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		plain, patterns []string
+		errs            []error
+	)
+	for _, o := range list {
+		if p, ok := strings.CutPrefix(o, "re:"); ok {
+			if _, err := compileOriginPattern(p); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			patterns = append(patterns, p)
+			continue
+		}
+		if strings.TrimSpace(o) == "*" && d.noWildcard.Load() {
+			errs = append(errs, errors.New(`cors: "*" from dynamic origins is ignored with AllowCredentials`))
+			continue
+		}
+		one, oerrs := normalizeOrigins([]string{o})
+		if len(oerrs) > 0 {
+			errs = append(errs, oerrs...)
+			continue
+		}
+		plain = append(plain, one...)
+	}
+	m, err := compileOrigins(plain, patterns)
+	if err != nil {
+		return err
+	}
+	d.cur.Store(m)
+	return errors.Join(errs...)
+}
+
+// forbidWildcard — для политики с AllowCredentials: "*" больше не принимается
+// (как и в статическом списке, см. ValidateCORS); текущий список перечитывается.
+func (d *DynamicOrigins) forbidWildcard() error {
+	d.noWildcard.Store(true)
+	return d.Reload(context.Background())
+}
+
+func (d *DynamicOrigins) Allow(_ context.Context, origin string) bool {
+	return d.cur.Load().match(requestOrigin(origin))
+}
+
+// Start — периодический Reload (every <= 0 — только ручной).
+func (d *DynamicOrigins) Start(onErr func(error)) {
+	if d.every <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(d.every)
+		defer t.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-t.C:
+				if err := d.Reload(context.Background()); err != nil && onErr != nil {
+					onErr(err)
+				}
+			}
+		}
+	}()
+}
+
+func (d *DynamicOrigins) Stop() { d.once.Do(func() { close(d.stop) }) }
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCORSPolicy — имя политики из Config.CORS в таблице роутов.
+const DefaultCORSPolicy = "default"
+
+const corsCatchAll = "/*cors_preflight"
+
+// CORSPolicy — все роуты группы (и вложенных) работают по именованной
+// политике из Config.CORSPolicies; preflight на пути группы (и на самом корне
+// группы — без редиректа на "/", которому preflight не следует) отвечает по ней же.
+// Вложенные группы с разными политиками и RouteCORSPolicy внутри такой группы
+// не поддерживаются (конфликт OPTIONS‑маршрутов в gin).
+func (r *Routes) CORSPolicy(name string) {
+	prefix := strings.TrimSuffix(r.BasePath(), "/")
+	r.set.corsPrefixes[prefix] = name
+	if prefix != "" {
+		r.set.corsExact[prefix] = name
+	}
+	r.OPTIONS(corsCatchAll, corsPolicyMarker)
+	if prefix != "" {
+		r.OPTIONS("", corsPolicyMarker)
+	}
+}
+
+// RouteCORSPolicy — политика для одного пути (все методы на нём).
+func (r *Routes) RouteCORSPolicy(path, name string) {
+	r.set.corsExact[joinRoutePath(r.BasePath(), path)] = name
+	r.OPTIONS(path, corsPolicyMarker)
+}
+
+// corsPolicyMarker — OPTIONS‑роут, без которого gin не отдаст preflight мидлвару
+// (405/404 раньше). Сам preflight обрабатывает CORS мидлвар; сюда доходят только обычные OPTIONS.
+func corsPolicyMarker(c *gin.Context) { MethodNotAllowedHandler(c) }
+
+// joinRoutePath — как пути групп в gin: base + rel, "/" на конце rel сохраняется.
+func joinRoutePath(base, rel string) string {
+	if rel == "" {
+		return base
+	}
+	full := path.Join(base, rel)
+	if strings.HasSuffix(rel, "/") && !strings.HasSuffix(full, "/") {
+		full += "/"
+	}
+	return full
+}
+
+// corsRouter — выбор CORS‑политики по шаблону пути роута (c.FullPath()).
+type corsRouter struct {
+	def      *corsPolicy
+	named    map[string]*corsPolicy
+	tn       *tenants
+	exact    map[string]string // путь -> политика
+	prefixes []corsPrefix      // по убыванию длины
+}
+
+type corsPrefix struct{ prefix, name string } // prefix — путь группы без "/" на конце
+
+func newCORSRouter(def CORSConfig, named map[string]CORSConfig, tn *tenants) *corsRouter {
+	r := &corsRouter{
+		def:   newCORSPolicy(def),
+		named: make(map[string]*corsPolicy, len(named)),
+		tn:    tn,
+		exact: map[string]string{},
+	}
+	for name, cfg := range named {
+		r.named[name] = newCORSPolicy(cfg)
+	}
+	return r
+}
+
+func (r *corsRouter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, p := r.policyFor(c.FullPath())
+		p.handle(c, r.tn.originsFor(c))
+	}
+}
+
+// setRoutes — после регистрации: политики, записанные через Routes.
+// Возвращает имена политик, на которые ссылаются роуты, но которых нет в конфиге.
+func (r *corsRouter) setRoutes(set *routeSettings) []string {
+	var unknown []string
+	note := func(name string) {
+		if _, ok := r.named[name]; !ok && !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	for path, name := range set.corsExact {
+		r.exact[path] = name
+		note(name)
+	}
+	for prefix, name := range set.corsPrefixes {
+		r.prefixes = append(r.prefixes, corsPrefix{prefix, name})
+		note(name)
+	}
+	sort.Slice(r.prefixes, func(i, j int) bool { return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix) })
+	sort.Strings(unknown)
+	return unknown
+}
+
+// policyFor — имя и политика для шаблона пути; неизвестные имена — default.
+func (r *corsRouter) policyFor(fullPath string) (string, *corsPolicy) {
+	if fullPath == "" {
+		return DefaultCORSPolicy, r.def
+	}
+	name, ok := r.exact[fullPath]
+	if !ok {
+		for _, p := range r.prefixes {
+			if fullPath == p.prefix || strings.HasPrefix(fullPath, p.prefix+"/") {
+				name, ok = p.name, true
+				break
+			}
+		}
+	}
+	if p := r.named[name]; ok && p != nil {
+		return name, p
+	}
+	return DefaultCORSPolicy, r.def
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ValidateCORS — проверяет CORSConfig и возвращает копию с нормализованными
+// origin'ами (схема/хост в нижнем регистре, без порта по умолчанию, без "/").
+// Ошибочные origin'ы в копию не попадают; errs описывает каждую проблему.
+func ValidateCORS(cfg CORSConfig) (CORSConfig, []error) {
+	var errs []error
+	origins, oerrs := normalizeOrigins(cfg.AllowedOrigins)
+	errs = append(errs, oerrs...)
+	cfg.AllowedOrigins = origins
+
+	if cfg.AllowCredentials {
+		for _, o := range origins {
+			if o == "*" {
+				errs = append(errs, errors.New(`cors: AllowCredentials cannot be combined with "*" origin (browsers reject it)`))
+				break
+			}
+		}
+	}
+	for _, m := range cfg.AllowedMethods {
+		if m = strings.TrimSpace(m); m == "" || strings.ContainsAny(m, " ,") {
+			errs = append(errs, fmt.Errorf("cors: invalid method %q", m))
+		}
+	}
+	for _, h := range append(append([]string{}, cfg.AllowedHeaders...), cfg.ExposedHeaders...) {
+		if h = strings.TrimSpace(h); h == "" || strings.ContainsAny(h, " ,:") {
+			errs = append(errs, fmt.Errorf("cors: invalid header name %q", h))
+		}
+	}
+	for _, p := range cfg.AllowedOriginPatterns {
+		if _, err := compileOriginPattern(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	timing, terrs := normalizeOrigins(cfg.TimingAllowOrigins)
+	for _, e := range terrs {
+		errs = append(errs, fmt.Errorf("timing: %w", e))
+	}
+	cfg.TimingAllowOrigins = timing
+	if s := cfg.PreflightStatus; s != 0 && s != http.StatusOK && s != http.StatusNoContent {
+		errs = append(errs, fmt.Errorf("cors: PreflightStatus must be 200 or 204, got %d", s))
+	}
+	errs = append(errs, checkOneOf("ResourcePolicy", cfg.ResourcePolicy, "same-origin", "same-site", "cross-origin")...)
+	errs = append(errs, checkOneOf("OpenerPolicy", cfg.OpenerPolicy, "same-origin", "same-origin-allow-popups", "noopener-allow-popups", "unsafe-none")...)
+	errs = append(errs, checkOneOf("EmbedderPolicy", cfg.EmbedderPolicy, "require-corp", "credentialless", "unsafe-none")...)
+	if cfg.MaxAge < 0 {
+		errs = append(errs, errors.New("cors: negative MaxAge"))
+	}
+	return cfg, errs
+}
+
+func checkOneOf(field, v string, allowed ...string) []error {
+	if v == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if v == a {
+			return nil
+		}
+	}
+	return []error{fmt.Errorf("cors: %s %q, expected one of %s", field, v, strings.Join(allowed, ", "))}
+}
+
+func normalizeOrigins(in []string) ([]string, []error) {
+	var errs []error
+	out := make([]string, 0, len(in))
+	for _, raw := range normalize(in) {
+		o, err := canonicalOrigin(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cors: origin %q: %w", raw, err))
+			// "https://a.com/" — понятно, что имелось в виду: чиним, но сообщаем
+			if o == "" {
+				continue
+			}
+		}
+		out = append(out, o)
+	}
+	return unique(out), errs
+}
+
+var errTrailingSlash = errors.New("trailing slash (origin has no path)")
+
+// canonicalOrigin — scheme://host[:port] в канонической форме.
+// Поддерживает шаблоны "scheme://*.domain" и "scheme://host:*".
+func canonicalOrigin(raw string) (string, error) {
+	if raw == "*" || raw == "null" {
+		return raw, nil
+	}
+	const wildcard = "*."
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || scheme == "" || rest == "" {
+		return "", errors.New("expected scheme://host[:port]")
+	}
+	wild := strings.HasPrefix(rest, wildcard)
+	if wild {
+		rest = rest[len(wildcard):]
+	}
+	anyPort := strings.HasSuffix(strings.TrimSuffix(rest, "/"), ":*")
+	if anyPort {
+		if wild {
+			return "", errors.New("subdomain and port wildcards cannot be combined")
+		}
+		rest = strings.Replace(rest, ":*", "", 1)
+	}
+	if strings.Contains(rest, "*") {
+		return "", errors.New(`wildcard is only allowed as "scheme://*.domain" or "scheme://host:*"`)
+	}
+	u, err := url.Parse(strings.ToLower(scheme) + "://" + rest)
+	if err != nil {
+		return "", err
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || u.Opaque != "" {
+		return "", errors.New("userinfo, query and fragment are not allowed")
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+	if wild && (strings.HasPrefix(host, ".") || !strings.Contains(host, ".") && host != "localhost") {
+		return "", errors.New("wildcard needs a domain after \"*.\"")
+	}
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port != "" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	if wild {
+		host = wildcard + host
+	}
+	if anyPort {
+		if port != "" {
+			return "", errors.New("port wildcard with explicit port")
+		}
+		host += ":*"
+	}
+	out := u.Scheme + "://" + host
+	switch u.Path {
+	case "":
+		return out, nil
+	case "/":
+		return out, errTrailingSlash
+	}
+	return "", fmt.Errorf("path %q is not allowed", u.Path)
+}
+
+// requestOrigin — Origin запроса в той же канонической форме (для сравнения).
+func requestOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	if o, err := canonicalOrigin(origin); err == nil && !strings.Contains(o, "*") && o != "null" {
+		return o
+	}
+	return strings.ToLower(origin)
+}
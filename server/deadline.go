@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки бюджета запроса (TimeoutConfig.ClientDeadlineHeader).
+const (
+	RequestTimeoutHeader = "X-Request-Timeout"
+	GRPCTimeoutHeader    = "grpc-timeout"
+)
+
+var errBadDeadline = errors.New("invalid deadline header")
+
+// ParseDeadlineHeader — значение заголовка name: для grpc-timeout — до 8 цифр
+// и единица H, M, S, m, u, n ("5m" — 5 мс); для остальных — "1.5s"/"250ms"
+// (time.Duration) или "1500" (миллисекунды).
+func ParseDeadlineHeader(name, v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, errBadDeadline
+	}
+	if strings.EqualFold(name, GRPCTimeoutHeader) {
+		if d, ok := parseGRPCTimeout(v); ok {
+			return d, nil
+		}
+		return 0, errBadDeadline
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n < 0 {
+			return 0, errBadDeadline
+		}
+		return time.Duration(n) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errBadDeadline
+	}
+	return d, nil
+}
+
+var grpcUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcUnits[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// FormatGRPCTimeout — d в формате grpc-timeout (точность — миллисекунды,
+// для больших значений — секунды/минуты, чтобы влезть в 8 цифр).
+func FormatGRPCTimeout(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	const max = 99999999
+	for _, u := range []struct {
+		unit time.Duration
+		sfx  string
+	}{{time.Millisecond, "m"}, {time.Second, "S"}, {time.Minute, "M"}} {
+		if n := (d + u.unit - 1) / u.unit; n <= max {
+			return strconv.FormatInt(int64(n), 10) + u.sfx
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Hour), 10) + "H"
+}
+
+// Remaining — остаток бюджета запроса (дедлайн c.Request.Context()).
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	if d := time.Until(dl); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// ForwardDeadline — проставить остаток бюджета ctx исходящему запросу:
+//
+//	req, _ := http.NewRequestWithContext(c.Request.Context(), "GET", url, nil)
+//	server.ForwardDeadline(req.Context(), req.Header)
+//
+// headers — какие заголовки ставить; по умолчанию X-Request-Timeout и grpc-timeout.
+// grpc-timeout — в своём формате, остальные — в миллисекундах.
+func ForwardDeadline(ctx context.Context, h http.Header, headers ...string) {
+	d, ok := Remaining(ctx)
+	if !ok {
+		return
+	}
+	if len(headers) == 0 {
+		headers = []string{RequestTimeoutHeader, GRPCTimeoutHeader}
+	}
+	for _, name := range headers {
+		if strings.EqualFold(name, GRPCTimeoutHeader) {
+			h.Set(name, FormatGRPCTimeout(d))
+		} else {
+			h.Set(name, strconv.FormatInt(d.Milliseconds(), 10))
+		}
+	}
+}
+
+// DeadlineTransport — http.RoundTripper, который сам вызывает ForwardDeadline
+// для каждого запроса (base == nil — http.DefaultTransport; headers — как у ForwardDeadline).
+func DeadlineTransport(base http.RoundTripper, headers ...string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return deadlineTransport{base, headers}
+}
+
+type deadlineTransport struct {
+	base    http.RoundTripper
+	headers []string
+}
+
+func (t deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Deadline(); ok {
+		req = req.Clone(req.Context()) // RoundTripper не должен менять чужой запрос
+		ForwardDeadline(req.Context(), req.Header, t.headers...)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -7,12 +7,16 @@ import (
 )
 
 func RespondError(c *gin.Context, status int, code, message string, details any) {
-	c.AbortWithStatusJSON(status, gin.H{
+	c.AbortWithStatusJSON(status, errorBody(code, message, details))
+}
+
+func errorBody(code, message string, details any) gin.H {
+	return gin.H{
 		"ok":      false,
 		"error":   message,
 		"code":    code,
 		"details": details,
-	})
+	}
 }
 
 func NotFoundHandler(c *gin.Context) {
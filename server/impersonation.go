@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActorClaimsKey — исходные клеймы того, кто действует от чужого имени.
+const ActorClaimsKey = "actor_claims"
+
+// Impersonator — загружает клеймы целевого пользователя (роли, tenant и т.д.),
+// от имени которого хочет действовать actor. Без него в клеймах будет только "sub".
+type Impersonator interface {
+	Impersonate(c *gin.Context, actor Claims, subject string) (Claims, error)
+}
+
+// ImpersonatorFunc — функция как Impersonator.
+type ImpersonatorFunc func(c *gin.Context, actor Claims, subject string) (Claims, error)
+
+func (f ImpersonatorFunc) Impersonate(c *gin.Context, actor Claims, subject string) (Claims, error) {
+	return f(c, actor, subject)
+}
+
+// impersonate — обработка заголовка X-Act-As внутри AccessMiddleware.
+// Возвращает false, если ответ уже отправлен.
+func (a *Auth) impersonate(c *gin.Context, actor Claims) (Claims, bool) {
+	target := c.GetHeader(a.cfg.ImpersonationHeader)
+	if target == "" || target == actor.Subject() {
+		return actor, true
+	}
+	if !HasPermission(actor, a.cfg.ImpersonationPermission) {
+		a.record(c, "impersonation.denied", map[string]any{"actor": actor.Subject(), "subject": target})
+		RespondError(c, http.StatusForbidden, "impersonation_forbidden", "impersonation not allowed", nil)
+		return nil, false
+	}
+
+	claims := Claims{"sub": target}
+	if a.impersonator != nil {
+		cl, err := a.impersonator.Impersonate(c, actor, target)
+		if err == nil && cl == nil {
+			err = fmt.Errorf("impersonator returned no claims for %q", target)
+		}
+		if err != nil {
+			_ = c.Error(err)
+			a.record(c, "impersonation.failed", map[string]any{"actor": actor.Subject(), "subject": target})
+			RespondError(c, http.StatusForbidden, "impersonation_forbidden", "impersonation not allowed", nil)
+			return nil, false
+		}
+		claims = maps.Clone(cl) // "act" не должен попасть в map Impersonator'а
+	}
+	// цепочка act по RFC 8693 §4.1: текущий actor сверху, предыдущие — вложенно
+	act := map[string]any{"sub": actor.Subject()}
+	if prev, ok := actor["act"]; ok {
+		act["act"] = prev
+	}
+	claims["act"] = act
+
+	// типизированные клеймы actor'а из TypedValidator — иначе ClaimsAs[T] вернёт его, а не target
+	dropTypedClaims(c, AccessClaimsKey)
+	c.Set(ActorClaimsKey, actor)
+	a.record(c, "impersonation", map[string]any{"actor": actor.Subject(), "subject": target})
+	return claims, true
+}
+
+// Actor — клеймы "act" (непосредственный actor) или nil.
+func (c Claims) Actor() Claims {
+	switch v := c["act"].(type) {
+	case Claims:
+		return v
+	case map[string]any:
+		return Claims(v)
+	}
+	return nil
+}
+
+// ActorChain — subject'ы всей цепочки act, от ближайшего к исходному.
+func (c Claims) ActorChain() []string {
+	var out []string
+	for a := c.Actor(); a != nil; a = a.Actor() {
+		out = append(out, a.Subject())
+	}
+	return out
+}
+
+// IsImpersonated — запрос выполняется от чужого имени.
+func IsImpersonated(c *gin.Context) bool {
+	cl, _ := GetClaims(c)
+	return cl.Actor() != nil
+}
+
+// HasPermission — право есть в "scope"/"scp" или в списке "permissions".
+func HasPermission(cl Claims, perm string) bool {
+	if perm == "" {
+		return false
+	}
+	if Scopes(cl.Scopes()).Has(perm) {
+		return true
+	}
+	return Scopes(stringList(cl["permissions"], false)).Has(perm)
+}
+
+// RequireStepUp — маршрут требует свежей аутентификации ("auth_time" не старше maxAge;
+// 0 — не проверять) и недоступен при impersonation.
+func RequireStepUp(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl, ok := GetClaims(c)
+		if !ok {
+			RespondError(c, http.StatusUnauthorized, "no_token", "access token missing", nil)
+			return
+		}
+		if cl.Actor() != nil {
+			RespondError(c, http.StatusForbidden, "impersonation_forbidden", "not allowed while impersonating", nil)
+			return
+		}
+		if maxAge > 0 {
+			if at := cl.Time("auth_time"); at.IsZero() || time.Since(at) > maxAge {
+				RespondError(c, http.StatusUnauthorized, "step_up_required", "recent authentication required", nil)
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,402 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeyState string
+
+const (
+	KeyActive  KeyState = "active"  // им подписываем
+	KeyNext    KeyState = "next"    // уже опубликован, станет active при ротации
+	KeyRetired KeyState = "retired" // только для проверки ещё живых токенов
+)
+
+// SigningKey — асимметричный ключ подписи из Keyring.
+type SigningKey struct {
+	ID        string
+	Alg       string // "EdDSA" | "ES256"
+	Private   crypto.Signer
+	State     KeyState
+	CreatedAt time.Time
+	RetiredAt time.Time
+}
+
+func (k *SigningKey) Public() crypto.PublicKey { return k.Private.Public() }
+
+// Keyring — ключи подписи сервера: active/next/retired с ротацией по расписанию
+// и публикацией в /.well-known/jwks.json и PASERK‑листинге.
+// С KeyringConfig.Source ключи переживают перезапуск и общие у реплик.
+type Keyring struct {
+	cfg KeyringConfig
+	src KeySource
+
+	mu        sync.RWMutex
+	keys      []*SigningKey
+	rotatedAt time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func NewKeyring(cfg KeyringConfig) (*Keyring, error) {
+	if cfg.Alg == "" {
+		cfg.Alg = "EdDSA"
+	}
+	if cfg.Alg != "EdDSA" && cfg.Alg != "ES256" {
+		return nil, fmt.Errorf("keyring: unsupported alg %q", cfg.Alg)
+	}
+	if cfg.JWKSPath == "" {
+		cfg.JWKSPath = "/.well-known/jwks.json"
+	}
+	if cfg.PASERKPath == "" {
+		cfg.PASERKPath = "/.well-known/paserk.json"
+	}
+	if cfg.RetainRetired <= 0 {
+		cfg.RetainRetired = cfg.RotateEvery
+	}
+	k := &Keyring{cfg: cfg, src: cfg.Source, rotatedAt: time.Now(), stop: make(chan struct{})}
+	if k.src != nil {
+		keys, at, err := k.src.Load(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("keyring: load: %w", err)
+		}
+		if len(keys) > 0 {
+			if err := checkKeys(keys); err != nil {
+				return nil, err
+			}
+			k.keys, k.rotatedAt = keys, at
+			return k, nil
+		}
+	}
+	for _, st := range []KeyState{KeyActive, KeyNext} {
+		key, err := generateSigningKey(cfg.Alg)
+		if err != nil {
+			return nil, err
+		}
+		key.State = st
+		k.keys = append(k.keys, key)
+	}
+	if k.src != nil {
+		if err := k.src.Save(context.Background(), k.keys, k.rotatedAt); err != nil {
+			return nil, fmt.Errorf("keyring: save: %w", err)
+		}
+	}
+	return k, nil
+}
+
+// checkKeys — загруженный набор обязан содержать ровно один active.
+func checkKeys(keys []*SigningKey) error {
+	n := 0
+	for _, key := range keys {
+		if key.State == KeyActive {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("keyring: loaded %d active keys, want 1", n)
+	}
+	return nil
+}
+
+// Active — текущий ключ подписи.
+func (k *Keyring) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.State == KeyActive {
+			return key
+		}
+	}
+	return nil
+}
+
+// Lookup — ключ по kid (для проверки подписи), включая next и retired.
+func (k *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Rotate — next -> active, active -> retired, генерируем новый next,
+// вычищаем retired старше RetainRetired. С Source новый набор сначала
+// сохраняется: при ошибке сохранения ключи не меняются.
+func (k *Keyring) Rotate() error {
+	fresh, err := generateSigningKey(k.cfg.Alg)
+	if err != nil {
+		return err
+	}
+	fresh.State = KeyNext
+	now := time.Now()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := make([]*SigningKey, 0, len(k.keys)+1)
+	for _, key := range k.keys {
+		cp := *key
+		switch cp.State {
+		case KeyActive:
+			cp.State, cp.RetiredAt = KeyRetired, now
+		case KeyNext:
+			cp.State = KeyActive
+		case KeyRetired:
+			if now.Sub(cp.RetiredAt) > k.cfg.RetainRetired {
+				continue
+			}
+		}
+		keys = append(keys, &cp)
+	}
+	keys = append(keys, fresh)
+	if k.src != nil {
+		if err := k.src.Save(context.Background(), keys, now); err != nil {
+			return fmt.Errorf("keyring: save: %w", err)
+		}
+	}
+	k.keys, k.rotatedAt = keys, now
+	return nil
+}
+
+// reload — подхватить ключи из Source, если их уже ротировала другая реплика.
+func (k *Keyring) reload() error {
+	if k.src == nil {
+		return nil
+	}
+	keys, at, err := k.src.Load(context.Background())
+	if err != nil {
+		return fmt.Errorf("keyring: load: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := checkKeys(keys); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if at.After(k.rotatedAt) {
+		k.keys, k.rotatedAt = keys, at
+	}
+	return nil
+}
+
+// NextRotation — когда будет следующая ротация (zero — авто‑ротация выключена).
+func (k *Keyring) NextRotation() time.Time {
+	if k.cfg.RotateEvery <= 0 {
+		return time.Time{}
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.rotatedAt.Add(k.cfg.RotateEvery)
+}
+
+// Пауза перед повтором неудачной ротации: от keyringRetryMin, удваивается
+// до keyringRetryMax.
+const (
+	keyringRetryMin = time.Second
+	keyringRetryMax = 5 * time.Minute
+)
+
+// Start — фоновая ротация по RotateEvery; onErr может быть nil.
+// Перед ротацией ключи перечитываются из Source: если реплика уже ротировала,
+// берём её набор. Ошибка — повтор с экспоненциальной паузой.
+func (k *Keyring) Start(onErr func(error)) {
+	if k.cfg.RotateEvery <= 0 {
+		return
+	}
+	go func() {
+		var retry time.Duration
+		for {
+			wait := time.Until(k.NextRotation())
+			if retry > 0 {
+				wait = retry
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-k.stop:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			err := k.reload()
+			if err == nil && !time.Now().Before(k.NextRotation()) {
+				err = k.Rotate()
+			}
+			if err == nil {
+				retry = 0
+				continue
+			}
+			if onErr != nil {
+				onErr(err)
+			}
+			retry = min(max(2*retry, keyringRetryMin), keyringRetryMax)
+		}
+	}()
+}
+
+func (k *Keyring) Stop() { k.once.Do(func() { close(k.stop) }) }
+
+// JWK — публичный ключ в формате RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// JWKS — все опубликованные ключи (active, next, retired).
+func (k *Keyring) JWKS() []JWK {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		j := publicJWK(key.Public())
+		j.Kid, j.Use, j.Alg = key.ID, "sig", key.Alg
+		out = append(out, j)
+	}
+	return out
+}
+
+// PASERKEntry — публичный ключ PASETO v4 в виде PASERK (k4.public.*).
+type PASERKEntry struct {
+	Kid    string   `json:"kid"`
+	PASERK string   `json:"paserk"`
+	Status KeyState `json:"status"`
+}
+
+// PASERKs — только Ed25519 ключи (PASETO v4.public).
+func (k *Keyring) PASERKs() []PASERKEntry {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := []PASERKEntry{}
+	for _, key := range k.keys {
+		if pub, ok := key.Public().(ed25519.PublicKey); ok {
+			out = append(out, PASERKEntry{
+				Kid:    key.ID,
+				PASERK: "k4.public." + b64(pub),
+				Status: key.State,
+			})
+		}
+	}
+	return out
+}
+
+func (k *Keyring) Register(r *gin.RouterGroup) {
+	r.GET(k.cfg.JWKSPath, func(c *gin.Context) {
+		k.serveCached(c, gin.H{"keys": k.JWKS()})
+	})
+	if k.cfg.Alg == "EdDSA" {
+		r.GET(k.cfg.PASERKPath, func(c *gin.Context) {
+			k.serveCached(c, gin.H{"keys": k.PASERKs()})
+		})
+	}
+}
+
+// serveCached — ключ next публикуется заранее, поэтому кэшу достаточно
+// обновиться до следующей ротации: max-age = время до неё.
+func (k *Keyring) serveCached(c *gin.Context, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		_ = c.Error(err)
+		RespondError(c, http.StatusInternalServerError, "internal_error", "internal server error", nil)
+		return
+	}
+	sum := sha256.Sum256(b)
+	etag := `"` + b64(sum[:12]) + `"`
+
+	maxAge := time.Hour
+	if next := k.NextRotation(); !next.IsZero() {
+		maxAge = time.Until(next)
+	}
+	secs := int(math.Max(0, math.Floor(maxAge.Seconds())))
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(secs))
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", b)
+}
+
+/* helpers */
+
+func generateSigningKey(alg string) (*SigningKey, error) {
+	var priv crypto.Signer
+	switch alg {
+	case "EdDSA":
+		_, p, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		priv = p
+	case "ES256":
+		p, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		priv = p
+	default:
+		return nil, errors.New("keyring: unsupported alg " + alg)
+	}
+	return &SigningKey{
+		ID:        jwkThumbprint(publicJWK(priv.Public())),
+		Alg:       alg,
+		Private:   priv,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func publicJWK(pub crypto.PublicKey) JWK {
+	switch p := pub.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: b64(p)}
+	case *ecdsa.PublicKey:
+		ep, err := p.ECDH()
+		if err != nil {
+			return JWK{}
+		}
+		// несжатая точка: 0x04 || X || Y
+		raw := ep.Bytes()[1:]
+		size := len(raw) / 2
+		return JWK{Kty: "EC", Crv: p.Curve.Params().Name, X: b64(raw[:size]), Y: b64(raw[size:])}
+	}
+	return JWK{}
+}
+
+// jwkThumbprint — kid по RFC 7638 (обязательные поля в лексикографическом порядке).
+func jwkThumbprint(j JWK) string {
+	var s string
+	if j.Kty == "EC" {
+		s = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, j.Crv, j.X, j.Y)
+	} else {
+		s = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, j.Crv, j.Kty, j.X)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return b64(sum[:])
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeySource — хранилище ключей Keyring. Load при старте и перед плановой
+// ротацией (так реплики подхватывают ключи друг друга), Save — после генерации
+// и каждой ротации. Пустой Load (nil, zero) — ключей ещё нет.
+// Для нескольких реплик Source должен быть общим (файл на общем томе, Vault, БД).
+type KeySource interface {
+	Load(ctx context.Context) (keys []*SigningKey, rotatedAt time.Time, err error)
+	Save(ctx context.Context, keys []*SigningKey, rotatedAt time.Time) error
+}
+
+// FileKeySource — ключи в JSON‑файле (закрытые ключи — PKCS#8, права 0600).
+// Запись атомарная: временный файл и rename.
+type FileKeySource struct {
+	Path string
+}
+
+func NewFileKeySource(path string) *FileKeySource { return &FileKeySource{Path: path} }
+
+type keyFile struct {
+	RotatedAt time.Time   `json:"rotated_at"`
+	Keys      []keyRecord `json:"keys"`
+}
+
+type keyRecord struct {
+	ID        string    `json:"kid"`
+	Alg       string    `json:"alg"`
+	State     KeyState  `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	RetiredAt time.Time `json:"retired_at,omitzero"`
+	Private   []byte    `json:"private"` // PKCS#8 DER
+}
+
+func (f *FileKeySource) Load(context.Context) ([]*SigningKey, time.Time, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	keys := make([]*SigningKey, 0, len(kf.Keys))
+	for _, r := range kf.Keys {
+		p, err := x509.ParsePKCS8PrivateKey(r.Private)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("%s: key %s: %w", f.Path, r.ID, err)
+		}
+		signer, ok := p.(crypto.Signer)
+		if !ok {
+			return nil, time.Time{}, fmt.Errorf("%s: key %s: not a signer", f.Path, r.ID)
+		}
+		keys = append(keys, &SigningKey{
+			ID:        r.ID,
+			Alg:       r.Alg,
+			Private:   signer,
+			State:     r.State,
+			CreatedAt: r.CreatedAt,
+			RetiredAt: r.RetiredAt,
+		})
+	}
+	return keys, kf.RotatedAt, nil
+}
+
+func (f *FileKeySource) Save(_ context.Context, keys []*SigningKey, rotatedAt time.Time) error {
+	kf := keyFile{RotatedAt: rotatedAt, Keys: make([]keyRecord, 0, len(keys))}
+	for _, key := range keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key.ID, err)
+		}
+		kf.Keys = append(kf.Keys, keyRecord{
+			ID:        key.ID,
+			Alg:       key.Alg,
+			State:     key.State,
+			CreatedAt: key.CreatedAt,
+			RetiredAt: key.RetiredAt,
+			Private:   der,
+		})
+	}
+	b, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
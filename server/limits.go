@@ -0,0 +1,243 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyUnlimited — значение в LimitsConfig.Routes: роут без лимита тела (загрузка файлов).
+const BodyUnlimited int64 = -1
+
+var (
+	ErrBodyTooLarge = errors.New("request body too large")
+	ErrBodyTimeout  = errors.New("request body is sent too slowly")
+)
+
+// RespondBodyError — для хендлеров: ошибка чтения/биндинга тела из‑за лимитов
+// превращается в 413/408. Возвращает false, если err — не про лимиты.
+// Звать не обязательно: если тело упёрлось в лимит, а хендлер ответил 4xx
+// (например, 400 после ошибки биндинга), мидлвар подменит ответ на 413/408.
+//
+//	if err := c.ShouldBindJSON(&req); err != nil {
+//		if !server.RespondBodyError(c, err) {
+//			server.RespondError(c, 400, "bad_request", err.Error(), nil)
+//		}
+//		return
+//	}
+func RespondBodyError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		RespondError(c, http.StatusRequestEntityTooLarge, "payload_too_large", "request body too large", nil)
+	case errors.Is(err, ErrBodyTimeout):
+		RespondError(c, http.StatusRequestTimeout, "body_timeout", "request body is sent too slowly", nil)
+	default:
+		return false
+	}
+	return true
+}
+
+// limits — лимиты запроса из LimitsConfig.
+type limits struct {
+	global  int64
+	cfg     map[string]int64
+	routes  routeTable[int64]
+	headers int
+	rate    int64
+	grace   time.Duration
+}
+
+func newLimits(cfg LimitsConfig) *limits {
+	l := &limits{
+		global:  cfg.MaxBodyBytes,
+		cfg:     cfg.Routes,
+		routes:  newRouteTable(cfg.Routes),
+		headers: cfg.MaxHeaderCount,
+		rate:    cfg.MinBodyRate,
+		grace:   cfg.MinBodyRateGrace,
+	}
+	if l.grace <= 0 {
+		l.grace = 5 * time.Second
+	}
+	return l
+}
+
+func (l *limits) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.headers > 0 {
+			n := 0
+			for _, v := range c.Request.Header {
+				n += len(v)
+			}
+			if n > l.headers {
+				RespondError(c, http.StatusRequestHeaderFieldsTooLarge, "headers_too_large",
+					fmt.Sprintf("too many header fields (max %d)", l.headers), nil)
+				return
+			}
+		}
+		l.run(c, l.configured(c.Request.Method, c.FullPath()))
+	}
+}
+
+// setRoutes — после регистрации: таблица конфига с записанным через Routes.
+func (l *limits) setRoutes(code map[string]int64) {
+	l.routes = newRouteTable(mergeRoutes(l.cfg, code))
+}
+
+// configured — лимит тела роута: Routes.BodyLimit/RouteBodyLimit > LimitsConfig.Routes > глобальный.
+func (l *limits) configured(method, fullPath string) int64 {
+	if n, ok := l.routes.lookup(method, fullPath); ok {
+		return n
+	}
+	return l.global
+}
+
+// run — остаток цепочки с лимитом тела max и контролем скорости чтения.
+// Если хендлер упёрся в лимит и ничего не ответил (или ответил 4xx),
+// отвечаем 413/408 сами.
+func (l *limits) run(c *gin.Context, max int64) {
+	if max > 0 && c.Request.ContentLength > max {
+		RespondError(c, http.StatusRequestEntityTooLarge, "payload_too_large",
+			fmt.Sprintf("request body exceeds %d bytes", max), nil)
+		return
+	}
+	if c.Request.Body == nil || c.Request.Body == http.NoBody || (max <= 0 && l.rate <= 0) {
+		c.Next()
+		return
+	}
+	b := &limitedBody{ReadCloser: c.Request.Body, max: max, rate: l.rate, grace: l.grace, start: time.Now()}
+	if l.rate > 0 {
+		// до буферного writer'а timeout'ов: дедлайн ставится на само соединение
+		ctl := http.NewResponseController(c.Writer)
+		b.ctl = ctl
+		defer func() {
+			// после медленного тела дедлайн оставляем: net/http не станет ждать
+			// остаток тела ради keep-alive и просто закроет соединение
+			if b.err != ErrBodyTimeout && b.ctl != nil {
+				_ = ctl.SetReadDeadline(time.Time{})
+			}
+		}()
+	}
+	c.Request.Body = b
+	w := &bodyLimitWriter{ResponseWriter: c.Writer, c: c, body: b}
+	c.Writer = w
+	c.Next()
+	c.Writer = w.ResponseWriter
+
+	if b.ctlErr != nil {
+		_ = c.Error(fmt.Errorf("limits: MinBodyRate checked only between reads: %w", b.ctlErr))
+	}
+	if b.err != nil && !c.Writer.Written() {
+		w.respond()
+	}
+}
+
+// bodyLimitWriter — если тело упёрлось в лимит, а хендлер отвечает 4xx
+// (обычно 400 после ошибки биндинга), вместо его ответа уходит 413/408.
+type bodyLimitWriter struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	body     *limitedBody
+	replaced bool
+}
+
+func (w *bodyLimitWriter) WriteHeader(code int) {
+	if w.replaced {
+		return
+	}
+	if w.body.err != nil && !w.ResponseWriter.Written() && code >= 400 && code < 500 {
+		w.respond()
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodyLimitWriter) WriteHeaderNow() {
+	if !w.replaced {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *bodyLimitWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLimitWriter) WriteString(s string) (int, error) {
+	if w.replaced {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyLimitWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// respond — 413/408 мимо обёртки; дальнейшие записи хендлера отбрасываются.
+func (w *bodyLimitWriter) respond() {
+	w.replaced = true
+	cur := w.c.Writer
+	w.c.Writer = w.ResponseWriter
+	defer func() { w.c.Writer = cur }()
+	if w.body.err == ErrBodyTimeout {
+		w.c.Header("Connection", "close")
+	}
+	RespondBodyError(w.c, w.body.err)
+}
+
+// limitedBody — тело запроса с лимитом размера и минимальной скоростью:
+// к моменту start+grace+n/rate клиент должен прислать n байт. Дедлайн чтения
+// ставится на соединение, так что зависший клиент не держит Read вечно
+// (где это не поддерживается — проверяем скорость после каждого Read).
+type limitedBody struct {
+	io.ReadCloser
+	max   int64
+	rate  int64
+	grace time.Duration
+	start time.Time
+	ctl   *http.ResponseController
+
+	n      int64
+	err    error
+	ctlErr error // дедлайн чтения не поддерживается (проверяем скорость между Read)
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.max > 0 && int64(len(p)) > b.max-b.n+1 {
+		p = p[:b.max-b.n+1] // +1 байт — чтобы заметить превышение
+	}
+	if b.ctl != nil {
+		if err := b.ctl.SetReadDeadline(b.due(b.n + 1)); err != nil {
+			b.ctl, b.ctlErr = nil, err
+		}
+	}
+	k, err := b.ReadCloser.Read(p)
+	b.n += int64(k)
+	switch {
+	case b.max > 0 && b.n > b.max:
+		k -= int(b.n - b.max)
+		b.n = b.max
+		b.err = ErrBodyTooLarge
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		b.err = ErrBodyTimeout
+	case err == nil && b.rate > 0 && time.Now().After(b.due(b.n)):
+		b.err = ErrBodyTimeout
+	default:
+		return k, err
+	}
+	return k, b.err
+}
+
+// due — к какому моменту должно прийти n байт тела.
+func (b *limitedBody) due(n int64) time.Time {
+	return b.start.Add(b.grace + time.Duration(float64(n)/float64(b.rate)*float64(time.Second)))
+}
@@ -1,66 +1,172 @@
 package server
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Периодическая ротация (LogConfig.RotateEvery).
+const (
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
 )
 
+// LogCompressor — сжатие ротированных файлов: ext — суффикс архива (".gz").
+// NewReader нужен только для чтения бэкапов (VerifyAuditFile).
+type LogCompressor struct {
+	Ext       string
+	NewWriter func(io.Writer) (io.WriteCloser, error)
+	NewReader func(io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]LogCompressor{
+		"gzip": {
+			Ext:       ".gz",
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		},
+		"zstd": {
+			Ext:       ".zst",
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				d, err := zstd.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return d.IOReadCloser(), nil
+			},
+		},
+	}
+)
+
+// RegisterLogCompressor — ещё один алгоритм для LogConfig.RotateCompress
+// (встроены "gzip" и "zstd").
+func RegisterLogCompressor(name string, c LogCompressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[name] = c
+}
+
+const backupTimeFormat = "20060102-150405"
+
+// rotatingWriter — файл лога с ротацией по размеру и/или времени.
+// Бэкапы: <path>.<YYYYMMDD-HHMMSS>[-N][.gz], время — момент ротации.
+// Сжатие и чистка (RotateBackups штук, не старше RotateMaxAge) — в фоне.
 type rotatingWriter struct {
-	path    string
-	maxSize int64
-	backups int
+	path     string
+	maxSize  int64
+	every    string
+	keep     int // сколько бэкапов хранить; 0 — без ограничения
+	maxAge   time.Duration
+	compress *LogCompressor
+	backupRe *regexp.Regexp
+	now      func() time.Time
+
+	mu      sync.Mutex
 	cur     *os.File
 	written int64
+	next    time.Time // следующая ротация по времени
+
+	kick chan struct{} // есть что сжать/почистить
+	done chan struct{}
 }
 
-func newRotatingWriter(path string, maxSize int64, backups int) (io.WriteCloser, error) {
-	if path == "" || maxSize <= 0 {
-		return nopCloser{Writer: mustOpen(path)}, nil
+func newRotatingWriter(path string, cfg LogConfig) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{Writer: os.Stdout}, nil
+	}
+	w := &rotatingWriter{
+		path:    path,
+		maxSize: cfg.RotateMaxSizeBytes,
+		every:   cfg.RotateEvery,
+		keep:    cfg.RotateBackups,
+		maxAge:  cfg.RotateMaxAge,
+		now:     time.Now,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	w.backupRe = backupRegexp(path)
+	switch w.every {
+	case "", RotateHourly, RotateDaily:
+	default:
+		return nil, fmt.Errorf("log: unknown RotateEvery %q (hourly, daily)", w.every)
+	}
+	if cfg.RotateCompress != "" {
+		compressorsMu.RLock()
+		c, ok := compressors[cfg.RotateCompress]
+		compressorsMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("log: unknown compressor %q (see RegisterLogCompressor)", cfg.RotateCompress)
+		}
+		w.compress = &c
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
 	}
-	w := &rotatingWriter{path: path, maxSize: maxSize, backups: backups}
 	if err := w.open(); err != nil {
 		return nil, err
 	}
+	go w.worker()
+	w.kick <- struct{}{} // досжать/дочистить то, что осталось с прошлого запуска
 	return w, nil
 }
+
+// backupRegexp — имена бэкапов path; старые схемы (<path>.N, <path>.<время>.N)
+// тоже бэкапы — чистятся вместе с новыми.
+func backupRegexp(path string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(path)) +
+		`\.(\d{8}-\d{6}([.-]\d+)?|\d+)(\.[a-z0-9]+)?$`)
+}
+
 func (w *rotatingWriter) open() error {
 	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
 	}
 	w.cur = f
+	w.written = 0
 	if fi, _ := f.Stat(); fi != nil {
 		w.written = fi.Size()
 	}
+	w.next = w.nextBoundary(w.now())
 	return nil
 }
-func (w *rotatingWriter) rotate() error {
-	if w.cur != nil {
-		_ = w.cur.Close()
-		w.cur = nil
-	}
-	for i := w.backups - 1; i >= 1; i-- {
-		_ = os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
-	}
-	ts := time.Now().Format("20060102-150405")
-	_ = os.Rename(w.path, fmt.Sprintf("%s.%s.1", w.path, ts))
-	if w.backups > 0 {
-		_ = os.Remove(fmt.Sprintf("%s.%d", w.path, w.backups+1))
+
+// nextBoundary — начало следующего часа/дня (по локальному времени).
+func (w *rotatingWriter) nextBoundary(t time.Time) time.Time {
+	switch w.every {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
 	}
-	w.written = 0
-	return w.open()
+	return time.Time{}
 }
+
 func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if w.cur == nil {
 		if err := w.open(); err != nil {
 			return 0, err
 		}
 	}
-	if w.maxSize > 0 && w.written+int64(len(p)) > w.maxSize {
-		if err := w.rotate(); err != nil {
+	due := !w.next.IsZero() && !w.now().Before(w.next)
+	full := w.maxSize > 0 && w.written > 0 && w.written+int64(len(p)) > w.maxSize
+	if due || full {
+		if err := w.rotateLocked(); err != nil {
 			return 0, err
 		}
 	}
@@ -68,25 +174,186 @@ func (w *rotatingWriter) Write(p []byte) (int, error) {
 	w.written += int64(n)
 	return n, err
 }
-func (w *rotatingWriter) Close() error {
-	if w.cur != nil {
-		return w.cur.Close()
+
+func (w *rotatingWriter) rotateLocked() error {
+	if err := w.cur.Close(); err != nil {
+		return err
+	}
+	w.cur = nil
+	if w.written > 0 {
+		name := w.backupName(w.now())
+		if err := os.Rename(w.path, name); err != nil {
+			return err
+		}
+		select {
+		case w.kick <- struct{}{}:
+		default: // воркер и так проснётся
+		}
+	}
+	return w.open()
+}
+
+// backupName — <path>.<время>, при коллизии в ту же секунду — с -N.
+func (w *rotatingWriter) backupName(t time.Time) string {
+	base := w.path + "." + t.Format(backupTimeFormat)
+	name := base
+	for i := 1; ; i++ {
+		if !w.exists(name) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func (w *rotatingWriter) exists(name string) bool {
+	if _, err := os.Stat(name); err == nil {
+		return true
+	}
+	if w.compress != nil {
+		if _, err := os.Stat(name + w.compress.Ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Reopen — открыть path заново (после внешнего logrotate, переименовавшего файл).
+// Новый файл открывается до закрытия старого: запись не прерывается и строки не теряются.
+func (w *rotatingWriter) Reopen() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := w.cur
+	w.cur = f
+	w.written = 0
+	if fi, _ := f.Stat(); fi != nil {
+		w.written = fi.Size()
+	}
+	if old != nil {
+		return old.Close()
 	}
 	return nil
 }
 
-type nopCloser struct{ io.Writer }
+// reopener — writer логов, который умеет Reopen (rotatingWriter).
+type reopener interface{ Reopen() error }
 
-func (n nopCloser) Close() error { return nil }
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.kick != nil {
+		close(w.kick)
+		<-w.done
+		w.kick = nil
+	}
+	if w.cur == nil {
+		return nil
+	}
+	err := w.cur.Close()
+	w.cur = nil
+	return err
+}
 
-func mustOpen(path string) *os.File {
-	if path == "" {
-		return os.Stdout
+func (w *rotatingWriter) worker() {
+	defer close(w.done)
+	for range w.kick {
+		if w.compress != nil {
+			w.compressAll()
+		}
+		w.prune()
+	}
+}
+
+// listBackups — ротированные файлы этого лога, от новых к старым.
+func (w *rotatingWriter) listBackups() []backupFile {
+	dir := filepath.Dir(w.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []backupFile
+	for _, e := range entries {
+		if e.IsDir() || !w.backupRe.MatchString(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, backupFile{path: filepath.Join(dir, e.Name()), mod: fi.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].mod.Equal(out[j].mod) {
+			return out[i].mod.After(out[j].mod)
+		}
+		return out[i].path > out[j].path
+	})
+	return out
+}
+
+type backupFile struct {
+	path string
+	mod  time.Time
+}
+
+func (w *rotatingWriter) prune() {
+	cutoff := time.Time{}
+	if w.maxAge > 0 {
+		cutoff = w.now().Add(-w.maxAge)
+	}
+	for i, b := range w.listBackups() {
+		if (w.keep > 0 && i >= w.keep) || (!cutoff.IsZero() && b.mod.Before(cutoff)) {
+			_ = os.Remove(b.path)
+		}
+	}
+}
+
+func (w *rotatingWriter) compressAll() {
+	for _, b := range w.listBackups() {
+		if strings.HasSuffix(b.path, w.compress.Ext) {
+			continue
+		}
+		_ = compressFile(b.path, b.path+w.compress.Ext, w.compress, b.mod)
+	}
+}
+
+// compressFile — src -> dst через временный файл; src удаляется, mtime сохраняется
+// (по нему считается возраст и порядок бэкапов).
+func compressFile(src, dst string, c *LogCompressor, mod time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
-	_ = os.MkdirAll(filepath.Dir(path), 0o755)
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	zw, err := c.NewWriter(out)
+	if err == nil {
+		_, err = io.Copy(zw, in)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
 	}
-	return f
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	_ = os.Chtimes(dst, mod, mod)
+	return os.Remove(src)
 }
+
+type nopCloser struct{ io.Writer }
+
+func (n nopCloser) Close() error { return nil }
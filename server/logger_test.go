@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestWriter(t *testing.T, cfg LogConfig) (*rotatingWriter, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	wc, err := newRotatingWriter(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = wc.Close() })
+	return wc.(*rotatingWriter), path
+}
+
+// setClock — подменить часы writer'а (и пересчитать следующую границу ротации).
+func (w *rotatingWriter) setClock(now func() time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = now
+	w.next = w.nextBoundary(now())
+}
+
+// readLog — содержимое бэкапов (от старых к новым) и текущего файла.
+func readLog(t *testing.T, w *rotatingWriter) (files []string, all []byte) {
+	t.Helper()
+	backups := w.listBackups()
+	for i := len(backups) - 1; i >= 0; i-- {
+		files = append(files, backups[i].path)
+	}
+	files = append(files, w.path)
+	for _, name := range files {
+		r, err := openLogFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, b...)
+	}
+	return files, all
+}
+
+func TestRotatingWriterSizeBoundary(t *testing.T) {
+	w, path := newTestWriter(t, LogConfig{RotateMaxSizeBytes: 10})
+
+	mustWrite(t, w, "0123456789") // ровно maxSize — без ротации
+	if n := len(w.listBackups()); n != 0 {
+		t.Fatalf("%d backups after exactly maxSize", n)
+	}
+	mustWrite(t, w, "a") // не влезает — ротация до записи
+	backups := w.listBackups()
+	if len(backups) != 1 {
+		t.Fatalf("%d backups, want 1", len(backups))
+	}
+	if b, _ := os.ReadFile(backups[0].path); string(b) != "0123456789" {
+		t.Fatalf("backup %q", b)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "a" {
+		t.Fatalf("current %q", b)
+	}
+
+	// запись больше maxSize в пустой файл не рвётся и не ротирует пустой файл
+	w2, path2 := newTestWriter(t, LogConfig{RotateMaxSizeBytes: 4})
+	mustWrite(t, w2, "0123456789")
+	if n := len(w2.listBackups()); n != 0 {
+		t.Fatalf("%d backups after oversized first write", n)
+	}
+	if b, _ := os.ReadFile(path2); string(b) != "0123456789" {
+		t.Fatalf("current %q", b)
+	}
+}
+
+func TestRotatingWriterTimeBoundary(t *testing.T) {
+	w, _ := newTestWriter(t, LogConfig{RotateEvery: RotateHourly})
+	var (
+		mu  sync.Mutex
+		now = time.Date(2024, 3, 1, 10, 59, 59, 0, time.Local)
+	)
+	clock := func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	set := func(t time.Time) { mu.Lock(); now = t; mu.Unlock() }
+	w.setClock(clock)
+
+	mustWrite(t, w, "before\n")
+	set(time.Date(2024, 3, 1, 10, 59, 59, 999_999_999, time.Local))
+	mustWrite(t, w, "still before\n")
+	if n := len(w.listBackups()); n != 0 {
+		t.Fatalf("%d backups before the hour", n)
+	}
+
+	set(time.Date(2024, 3, 1, 11, 0, 0, 0, time.Local)) // ровно на границе — ротация
+	mustWrite(t, w, "after\n")
+	backups := w.listBackups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0].path, ".20240301-110000") {
+		t.Fatalf("backups %v", backups)
+	}
+
+	set(time.Date(2024, 3, 1, 11, 59, 0, 0, time.Local))
+	mustWrite(t, w, "same hour\n")
+	if n := len(w.listBackups()); n != 1 {
+		t.Fatalf("%d backups within the hour, want 1", n)
+	}
+	_, all := readLog(t, w)
+	if string(all) != "before\nstill before\nafter\nsame hour\n" {
+		t.Fatalf("log %q", all)
+	}
+}
+
+func TestRotatingWriterKeepsBackups(t *testing.T) {
+	w, _ := newTestWriter(t, LogConfig{RotateMaxSizeBytes: 4, RotateBackups: 2})
+	for i := range 6 {
+		mustWrite(t, w, fmt.Sprintf("%04d", i))
+	}
+	_ = w.Close() // дождаться воркера
+	files, all := readLog(t, w)
+	if len(files) != 3 || string(all) != "000300040005" {
+		t.Fatalf("files %v, log %q", files, all)
+	}
+}
+
+// TestRotatingWriterConcurrent — строки из многих горутин не рвутся и не теряются,
+// ни один файл не превышает maxSize. Запускать с -race.
+func TestRotatingWriterConcurrent(t *testing.T) {
+	const (
+		writers = 8
+		lines   = 500
+		lineLen = 32
+		maxSize = 4 << 10
+	)
+	w, _ := newTestWriter(t, LogConfig{RotateMaxSizeBytes: maxSize, RotateCompress: "gzip"})
+	var wg sync.WaitGroup
+	for g := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range lines {
+				line := fmt.Sprintf("g%02d-%05d", g, i)
+				line += strings.Repeat(".", lineLen-len(line)-1) + "\n"
+				if _, err := w.Write([]byte(line)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	_ = w.Close()
+
+	files, all := readLog(t, w)
+	for _, name := range files[:len(files)-1] {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("backup %s not compressed", name)
+		}
+	}
+	got := map[string]bool{}
+	for _, line := range bytes.Split(bytes.TrimSuffix(all, []byte("\n")), []byte("\n")) {
+		if len(line) != lineLen-1 {
+			t.Fatalf("torn line %q", line)
+		}
+		got[string(line[:9])] = true
+	}
+	if len(got) != writers*lines {
+		t.Fatalf("%d distinct lines, want %d", len(got), writers*lines)
+	}
+	for _, name := range files {
+		r, err := openLogFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := io.Copy(io.Discard, r)
+		r.Close()
+		if n > maxSize {
+			t.Errorf("%s: %d bytes > maxSize", name, n)
+		}
+	}
+}
+
+func TestRotatingWriterCompressors(t *testing.T) {
+	for _, name := range []string{"gzip", "zstd"} {
+		t.Run(name, func(t *testing.T) {
+			w, _ := newTestWriter(t, LogConfig{RotateMaxSizeBytes: 16, RotateCompress: name})
+			for i := range 5 {
+				mustWrite(t, w, fmt.Sprintf("line %02d of log\n", i)) // 16 байт — по строке на файл
+			}
+			_ = w.Close()
+			files, all := readLog(t, w)
+			ext := compressors[name].Ext
+			for _, f := range files[:len(files)-1] {
+				if !strings.HasSuffix(f, ext) {
+					t.Errorf("backup %s without %s", f, ext)
+				}
+			}
+			want := ""
+			for i := range 5 {
+				want += fmt.Sprintf("line %02d of log\n", i)
+			}
+			if string(all) != want {
+				t.Fatalf("log %q", all)
+			}
+		})
+	}
+}
+
+func mustWrite(t *testing.T, w io.Writer, s string) {
+	t.Helper()
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
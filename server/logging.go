@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+const loggerKey = "logger"
+
+type loggerCtxKey struct{}
+
+// Logger — логгер сервера с request_id текущего запроса:
+//
+//	server.Logger(c).Info("order created", "order_id", id)
+//
+// Вне сервера (нет мидлвара) — slog.Default().
+func Logger(c *gin.Context) *slog.Logger {
+	if l, ok := c.Get(loggerKey); ok {
+		return l.(*slog.Logger)
+	}
+	return LoggerFromContext(c.Request.Context())
+}
+
+// LoggerFromContext — то же для кода, который видит только context.Context.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerCtxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// ContextWithLogger — положить логгер в ctx (для LoggerFromContext).
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, l)
+}
+
+// RequestLogger — ставится после RequestID: логгер запроса с request_id
+// в gin.Context и c.Request.Context().
+func RequestLogger(base *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := base.With("request_id", c.GetString("request_id"))
+		c.Set(loggerKey, l)
+		c.Request = c.Request.WithContext(ContextWithLogger(c.Request.Context(), l))
+		c.Next()
+	}
+}
+
+// requestLoggerOr — логгер запроса, если RequestLogger уже отработал, иначе base.
+func requestLoggerOr(c *gin.Context, base *slog.Logger) *slog.Logger {
+	if l, ok := c.Get(loggerKey); ok {
+		return l.(*slog.Logger)
+	}
+	if id := c.GetString("request_id"); id != "" {
+		return base.With("request_id", id)
+	}
+	return base
+}
+
+// newServerLogger — логгер по умолчанию: ErrorFile в формате LogConfig.ErrorFormat.
+// Уровень фильтрует logLevels поверх (он меняется на лету), сам handler пишет всё.
+func newServerLogger(w io.Writer, cfg LogConfig) (*slog.Logger, error) {
+	h, err := newSlogHandler(w, cfg.ErrorFormat, &slog.HandlerOptions{Level: slog.LevelDebug - 4})
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(h), nil
+}
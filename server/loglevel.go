@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Модули с отдельным уровнем (LogConfig.ModuleLevels, PUT /sys/log/level).
+// Модуль записи — атрибут "module" (Logger(c).With("module", LogModuleAuth)).
+const (
+	LogModuleAuth    = "auth"
+	LogModuleCORS    = "cors"
+	LogModuleTimeout = "timeout"
+	LogModuleAccess  = "access" // сам access‑лог; по умолчанию Info, от общего уровня не зависит
+)
+
+var logModules = []string{LogModuleAuth, LogModuleCORS, LogModuleTimeout, LogModuleAccess}
+
+// moduleLevel — уровень модуля; set=false — наследует общий.
+type moduleLevel struct {
+	level slog.LevelVar
+	set   atomic.Bool
+}
+
+// logLevels — общий уровень лога сервера и переопределения по модулям;
+// меняются на лету (/sys/log/level).
+type logLevels struct {
+	global  slog.LevelVar
+	modules map[string]*moduleLevel // набор модулей фиксирован — map только читается
+}
+
+func newLogLevels(cfg LogConfig) (*logLevels, error) {
+	l := &logLevels{modules: map[string]*moduleLevel{}}
+	l.global.Set(cfg.Level)
+	for _, m := range logModules {
+		l.modules[m] = &moduleLevel{}
+	}
+	l.modules[LogModuleAccess].set.Store(true) // Info
+	for m, lvl := range cfg.ModuleLevels {
+		if err := l.SetModule(m, &lvl); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// SetModule — уровень модуля; nil — снова наследовать общий (access — Info).
+func (l *logLevels) SetModule(module string, lvl *slog.Level) error {
+	m, ok := l.modules[module]
+	if !ok {
+		return fmt.Errorf("log: unknown module %q (%s)", module, strings.Join(logModules, ", "))
+	}
+	if lvl == nil {
+		m.level.Set(slog.LevelInfo)
+		m.set.Store(module == LogModuleAccess)
+		return nil
+	}
+	m.level.Set(*lvl)
+	m.set.Store(true)
+	return nil
+}
+
+// Level — действующий уровень модуля ("" — общий).
+func (l *logLevels) Level(module string) slog.Level {
+	if m, ok := l.modules[module]; ok && m.set.Load() {
+		return m.level.Level()
+	}
+	return l.global.Level()
+}
+
+// min — самый подробный из действующих уровней (для Enabled без модуля);
+// access не считается — у access‑лога свой handler.
+func (l *logLevels) min() slog.Level {
+	lvl := l.global.Level()
+	for name, m := range l.modules {
+		if name != LogModuleAccess && m.set.Load() {
+			lvl = min(lvl, m.level.Level())
+		}
+	}
+	return lvl
+}
+
+// Snapshot — для GET /sys/log/level: уровни модулей; null — наследует общий.
+func (l *logLevels) Snapshot() gin.H {
+	mods := gin.H{}
+	for name, m := range l.modules {
+		if m.set.Load() {
+			mods[name] = m.level.Level().String()
+		} else {
+			mods[name] = nil
+		}
+	}
+	return gin.H{"level": l.global.Level().String(), "modules": mods}
+}
+
+// handler — фильтр по уровню модуля. module == "" — модуль берётся из атрибута
+// "module" (в With(...) или в самой записи).
+func (l *logLevels) handler(module string, next slog.Handler) slog.Handler {
+	return &levelHandler{next: next, levels: l, module: module}
+}
+
+type levelHandler struct {
+	next   slog.Handler
+	levels *logLevels
+	module string
+}
+
+func (h *levelHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	if h.module != "" {
+		return lvl >= h.levels.Level(h.module)
+	}
+	return lvl >= h.levels.min() // точная проверка — в Handle, когда виден атрибут module
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	module := h.module
+	if module == "" {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "module" {
+				module = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if r.Level < h.levels.Level(module) || !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	module := h.module
+	for _, a := range attrs {
+		if a.Key == "module" {
+			module = a.Value.String()
+		}
+	}
+	return &levelHandler{next: h.next.WithAttrs(attrs), levels: h.levels, module: module}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name), levels: h.levels, module: h.module}
+}
+
+// AccessSampleRule — правило сэмплирования access‑лога (LogConfig.AccessSampling):
+// первое подходящее правило решает, какую долю записей писать; без совпадений — все.
+//
+//	{Route: "GET /api/v1/livez", Status: "2xx", Rate: 0.01} // 1% успешных проб, 5xx — все
+type AccessSampleRule struct {
+	Route  string  `json:"route,omitempty"`  // ключ как в TimeoutConfig.Routes; пусто — любой
+	Status string  `json:"status,omitempty"` // "2xx", "404"; пусто — любой
+	Rate   float64 `json:"rate"`             // 0..1
+}
+
+type accessSampleRule struct {
+	AccessSampleRule
+	routes        routeTable[bool]
+	class, status int // 2 для "2xx"; 404 для "404"
+}
+
+// accessSampler — неизменяемый набор правил; заменяется целиком (atomic.Pointer).
+type accessSampler struct {
+	rules []accessSampleRule
+}
+
+func newAccessSampler(rules []AccessSampleRule) (*accessSampler, error) {
+	s := &accessSampler{}
+	for i, r := range rules {
+		if r.Rate < 0 || r.Rate > 1 {
+			return nil, fmt.Errorf("log: sampling rule %d: rate must be in [0, 1]", i)
+		}
+		cr := accessSampleRule{AccessSampleRule: r}
+		if r.Route != "" {
+			cr.routes = newRouteTable(map[string]bool{r.Route: true})
+		}
+		switch st := strings.ToLower(r.Status); {
+		case st == "":
+		case len(st) == 3 && st[1:] == "xx" && st[0] >= '1' && st[0] <= '5':
+			cr.class = int(st[0] - '0')
+		default:
+			n, err := strconv.Atoi(st)
+			if err != nil || n < 100 || n > 599 {
+				return nil, fmt.Errorf("log: sampling rule %d: bad status %q (2xx, 404)", i, r.Status)
+			}
+			cr.status = n
+		}
+		s.rules = append(s.rules, cr)
+	}
+	return s, nil
+}
+
+// rate — доля записей для запроса; 1 — писать всё.
+func (s *accessSampler) rate(method, route string, status int) float64 {
+	for _, r := range s.rules {
+		if r.Route != "" {
+			if _, ok := r.routes.lookup(method, route); !ok {
+				continue
+			}
+		}
+		if (r.class != 0 && status/100 != r.class) || (r.status != 0 && status != r.status) {
+			continue
+		}
+		return r.Rate
+	}
+	return 1
+}
+
+// sample — писать ли запись; rate < 1 уходит в запись как sample_rate.
+func (s *accessSampler) sample(method, route string, status int) (float64, bool) {
+	rate := s.rate(method, route, status)
+	return rate, rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+func (s *accessSampler) Rules() []AccessSampleRule {
+	out := make([]AccessSampleRule, len(s.rules))
+	for i, r := range s.rules {
+		out[i] = r.AccessSampleRule
+	}
+	return out
+}
+
+// logControlEndpoints — /sys/log/level и /sys/log/sampling (в группе с авторизацией).
+func logControlEndpoints(s *Server, admin *gin.RouterGroup) {
+	admin.GET("/log/level", func(c *gin.Context) {
+		out := s.levels.Snapshot()
+		out["ok"] = true
+		c.JSON(http.StatusOK, out)
+	})
+
+	// {"level": "DEBUG", "modules": {"auth": "DEBUG", "cors": null}} — null/"" сбрасывает модуль
+	admin.PUT("/log/level", func(c *gin.Context) {
+		var req struct {
+			Level   string             `json:"level"`
+			Modules map[string]*string `json:"modules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondError(c, http.StatusBadRequest, "bad_request", err.Error(), nil)
+			return
+		}
+		// сначала всё разобрать, потом применить — без частичных изменений
+		var global *slog.Level
+		if req.Level != "" {
+			var lvl slog.Level
+			if err := lvl.UnmarshalText([]byte(req.Level)); err != nil {
+				RespondError(c, http.StatusBadRequest, "bad_request", err.Error(), nil)
+				return
+			}
+			global = &lvl
+		}
+		mods := make(map[string]*slog.Level, len(req.Modules))
+		names := make([]string, 0, len(req.Modules))
+		for name, v := range req.Modules {
+			if _, ok := s.levels.modules[name]; !ok {
+				RespondError(c, http.StatusBadRequest, "bad_request",
+					fmt.Sprintf("unknown module %q (%s)", name, strings.Join(logModules, ", ")), nil)
+				return
+			}
+			names = append(names, name)
+			if v == nil || *v == "" {
+				mods[name] = nil
+				continue
+			}
+			var lvl slog.Level
+			if err := lvl.UnmarshalText([]byte(*v)); err != nil {
+				RespondError(c, http.StatusBadRequest, "bad_request", err.Error(), nil)
+				return
+			}
+			mods[name] = &lvl
+		}
+		if global != nil {
+			s.levels.global.Set(*global)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_ = s.levels.SetModule(name, mods[name])
+		}
+		out := s.levels.Snapshot()
+		s.logger.Warn("log level changed", "level", out["level"], "modules", out["modules"])
+		out["ok"] = true
+		c.JSON(http.StatusOK, out)
+	})
+
+	admin.GET("/log/sampling", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "rules": s.access.sampler.Load().Rules()})
+	})
+
+	// {"rules": [{"route": "/api/v1/livez", "status": "2xx", "rate": 0.01}]} — заменяет все правила
+	admin.PUT("/log/sampling", func(c *gin.Context) {
+		var req struct {
+			Rules []AccessSampleRule `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			RespondError(c, http.StatusBadRequest, "bad_request", err.Error(), nil)
+			return
+		}
+		sm, err := newAccessSampler(req.Rules)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "bad_request", err.Error(), nil)
+			return
+		}
+		s.access.sampler.Store(sm)
+		s.logger.Warn("access sampling changed", "rules", len(req.Rules))
+		c.JSON(http.StatusOK, gin.H{"ok": true, "rules": sm.Rules()})
+	})
+}
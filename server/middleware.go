@@ -3,9 +3,13 @@ package server
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -31,28 +35,95 @@ func RequestID(headerName string) gin.HandlerFunc {
 
 // RecoveryJSON — перехватывает паники, пишет в лог и возвращает JSON 500.
 func RecoveryJSON(errWriter io.Writer) gin.HandlerFunc {
-	logger := log.New(errWriter, "[panic] ", log.LstdFlags|log.Lmsgprefix)
-	return gin.CustomRecoveryWithWriter(errWriter, func(c *gin.Context, err interface{}) {
-		logger.Printf("%s %s | panic: %v", c.Request.Method, c.Request.URL.Path, err)
-		RespondError(c, http.StatusInternalServerError, "internal_error", "internal server error", nil)
-	})
+	return RecoveryJSONWithLogger(slog.New(defaultRedactor().handler(slog.NewTextHandler(errWriter, nil))))
+}
+
+// RecoveryJSONWithLogger — RecoveryJSON со стеком паники в slog (уровень Error).
+// Обрыв соединения клиентом — Warn, без ответа.
+func RecoveryJSONWithLogger(l *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			stack := debug.Stack()
+			if hp, ok := p.(*handlerPanic); ok { // паника из‑под TimeoutMiddleware
+				p, stack = hp.value, hp.stack
+			}
+			log := requestLoggerOr(c, l)
+			if err, ok := p.(error); ok && (errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)) {
+				log.Warn("connection lost", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+				c.Abort()
+				return
+			}
+			log.Error("panic", "method", c.Request.Method, "path", c.Request.URL.Path,
+				"panic", fmt.Sprint(p), "stack", string(stack))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			RespondError(c, http.StatusInternalServerError, "internal_error", "internal server error", nil)
+		}()
+		c.Next()
+	}
 }
 
 // ErrorCapture — отправляйте ошибки через c.Error(err); мы их залогируем.
 func ErrorCapture(errWriter io.Writer) gin.HandlerFunc {
-	logger := log.New(errWriter, "[error] ", log.LstdFlags|log.Lmsgprefix)
+	return ErrorCaptureWithLogger(slog.New(defaultRedactor().handler(slog.NewTextHandler(errWriter, nil))))
+}
+
+// ErrorCaptureWithLogger — ErrorCapture в slog: ответ 5xx — Error, иначе Warn;
+// тип и c.Error(err).SetMeta(...) уходят в поля записи.
+func ErrorCaptureWithLogger(l *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		c.Next()
-		if len(c.Errors) > 0 {
-			for _, e := range c.Errors {
-				logger.Printf("%s %s -> %d in %s | %v",
-					c.Request.Method, c.Request.URL.Path, c.Writer.Status(), time.Since(start), e.Err)
+		if len(c.Errors) == 0 {
+			return
+		}
+		status := c.Writer.Status()
+		level := slog.LevelWarn
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		log := requestLoggerOr(c, l)
+		for _, e := range c.Errors {
+			attrs := []slog.Attr{
+				slog.String("method", c.Request.Method),
+				slog.String("path", c.Request.URL.Path),
+				slog.String("route", c.FullPath()),
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("error", e.Err.Error()),
+				slog.String("type", errorTypeName(e.Type)),
 			}
+			if e.Meta != nil {
+				attrs = append(attrs, slog.Any("meta", e.Meta))
+			}
+			log.LogAttrs(c.Request.Context(), level, "request error", attrs...)
 		}
 	}
 }
 
+func errorTypeName(t gin.ErrorType) string {
+	switch t {
+	case gin.ErrorTypeBind:
+		return "bind"
+	case gin.ErrorTypeRender:
+		return "render"
+	case gin.ErrorTypePublic:
+		return "public"
+	case gin.ErrorTypePrivate:
+		return "private"
+	}
+	return "other"
+}
+
 // Health — готовые health‑эндпоинты.
 func Health() (live gin.HandlerFunc, ready gin.HandlerFunc) {
 	live = func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true, "status": "live"}) }
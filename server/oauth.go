@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenStore — состояние выданных токенов. Его же консультируют
+// AccessMiddleware/RefreshMiddleware: отозванный токен = невалидный.
+type TokenStore interface {
+	// Revoke — отозвать токен; expiresAt — когда запись можно забыть (zero — никогда).
+	Revoke(ctx context.Context, token string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, token string) (bool, error)
+}
+
+// ClientAuthenticator — проверка client credentials для /oauth/*.
+type ClientAuthenticator interface {
+	AuthenticateClient(c *gin.Context, clientID, secret string) error
+}
+
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// StaticClients — client_id -> secret (для небольших инсталляций).
+type StaticClients map[string]string
+
+func (s StaticClients) AuthenticateClient(_ *gin.Context, id, secret string) error {
+	want, ok := s[id]
+	// сравниваем хэши, чтобы не светить длину секрета
+	a, b := sha256.Sum256([]byte(secret)), sha256.Sum256([]byte(want))
+	if !ok || subtle.ConstantTimeCompare(a[:], b[:]) != 1 {
+		return ErrInvalidClient
+	}
+	return nil
+}
+
+// MemoryTokenStore — TokenStore в памяти процесса; хранит sha256 токенов,
+// просроченные записи вычищаются при Revoke.
+type MemoryTokenStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{revoked: map[string]time.Time{}}
+}
+
+func (m *MemoryTokenStore) Revoke(_ context.Context, token string, expiresAt time.Time) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, exp := range m.revoked {
+		if !exp.IsZero() && exp.Before(now) {
+			delete(m.revoked, k)
+		}
+	}
+	m.revoked[tokenHash(token)] = expiresAt
+	return nil
+}
+
+func (m *MemoryTokenStore) IsRevoked(_ context.Context, token string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.revoked[tokenHash(token)]
+	return ok, nil
+}
+
+func tokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// OAuthEndpoints — /oauth/revoke (RFC 7009) и /oauth/introspect (RFC 7662).
+// Регистрируется как обычный RouteRegistrar; сервер подключает его сам
+// через WithOAuthEndpoints — вне AccessMiddleware, т.к. клиент
+// аутентифицируется своими credentials, а не bearer‑токеном.
+// Отозвать клиент может только выданные ему токены; интроспекция — любых
+// токенов, но только клиентам из IntrospectClients (resource server'ы).
+type OAuthEndpoints struct {
+	Validator TokenValidator
+	Store     TokenStore
+	Clients   ClientAuthenticator
+	// client_id, которым разрешён /oauth/introspect; остальным — 403
+	IntrospectClients []string
+}
+
+func (o *OAuthEndpoints) Register(r *gin.RouterGroup) {
+	g := r.Group("/oauth", o.clientAuth)
+	g.POST("/revoke", o.revoke)
+	g.POST("/introspect", o.introspect)
+}
+
+// clientAuth — HTTP Basic или client_id/client_secret в форме (RFC 6749 §2.3.1).
+func (o *OAuthEndpoints) clientAuth(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	if id == "" || o.Clients == nil {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication required")
+		return
+	}
+	if err := o.Clients.AuthenticateClient(c, id, secret); err != nil {
+		_ = c.Error(err)
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	c.Set("oauth_client_id", id)
+	c.Next()
+}
+
+func (o *OAuthEndpoints) revoke(c *gin.Context) {
+	tok := c.PostForm("token")
+	if tok == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+	// невалидный или чужой токен — всё равно 200 (RFC 7009 §2.1, §2.2)
+	claims, _, ok := o.validate(c, tok, c.PostForm("token_type_hint"))
+	if !ok || o.Store == nil || !issuedTo(claims, c.GetString("oauth_client_id")) {
+		c.Status(http.StatusOK)
+		return
+	}
+	if err := o.Store.Revoke(c.Request.Context(), tok, claims.ExpiresAt()); err != nil {
+		_ = c.Error(err)
+		oauthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "revocation failed")
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (o *OAuthEndpoints) introspect(c *gin.Context) {
+	if !slices.Contains(o.IntrospectClients, c.GetString("oauth_client_id")) {
+		oauthError(c, http.StatusForbidden, "unauthorized_client", "client is not allowed to introspect tokens")
+		return
+	}
+	tok := c.PostForm("token")
+	if tok == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+	claims, typ, ok := o.validate(c, tok, c.PostForm("token_type_hint"))
+	if ok && o.Store != nil {
+		revoked, err := o.Store.IsRevoked(c.Request.Context(), tok)
+		if err != nil {
+			_ = c.Error(err)
+			oauthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "token store unavailable")
+			return
+		}
+		ok = !revoked
+	}
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	out := gin.H{}
+	for k, v := range claims {
+		out[k] = v
+	}
+	// даты — в unix‑секундах, scope — строкой (RFC 7662 §2.2)
+	for _, k := range []string{"exp", "iat", "nbf"} {
+		if t := claims.Time(k); !t.IsZero() {
+			out[k] = t.Unix()
+		}
+	}
+	if sc := claims.Scopes(); len(sc) > 0 {
+		out["scope"] = strings.Join(sc, " ")
+	}
+	out["active"] = true
+	if typ == "access_token" {
+		out["token_type"] = "Bearer" // тип токена по RFC 6749 §7.1, а не hint
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// validate — пробуем тип из hint'а первым, потом второй.
+func (o *OAuthEndpoints) validate(c *gin.Context, tok, hint string) (Claims, string, bool) {
+	if o.Validator == nil {
+		return nil, "", false
+	}
+	order := []string{"access_token", "refresh_token"}
+	if hint == "refresh_token" {
+		order[0], order[1] = order[1], order[0]
+	}
+	for _, typ := range order {
+		var (
+			cl  Claims
+			err error
+		)
+		if typ == "access_token" {
+			cl, err = o.Validator.ValidateAccess(c, tok)
+		} else {
+			cl, err = o.Validator.ValidateRefresh(c, tok)
+		}
+		if err == nil {
+			return cl, typ, true
+		}
+	}
+	return nil, "", false
+}
+
+// issuedTo — токен выдан клиенту client: "client_id" или "azp" в клеймах.
+// Токен без них не принадлежит никому из клиентов.
+func issuedTo(cl Claims, client string) bool {
+	if client == "" {
+		return false
+	}
+	for _, k := range []string{"client_id", "azp"} {
+		if id, _ := cl[k].(string); id != "" {
+			return id == client
+		}
+	}
+	return false
+}
+
+// oauthError — ошибки /oauth/* в формате RFC 6749 §5.2 (клиенты ждут именно его,
+// а не формат RespondError).
+func oauthError(c *gin.Context, status int, code, desc string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": code, "error_description": desc})
+}
@@ -1,12 +1,27 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
 
 type Option func(*Server)
 
 func WithRegistrar(r RouteRegistrar) Option {
 	return func(s *Server) { s.routeRegs = append(s.routeRegs, r) }
 }
+
+// WithRoutes — регистратор с доступом к настройкам роутов (Routes.Timeout,
+// Routes.BodyLimit...) и к Auth сервера; вызывается в общем порядке с WithRegistrar.
+func WithRoutes(r RoutesRegistrar) Option {
+	return func(s *Server) {
+		s.routeRegs = append(s.routeRegs, HandlerFuncRegistrar(func(g *gin.RouterGroup) {
+			r.RegisterRoutes(&Routes{RouterGroup: g, set: s.routeSet, auth: s.auth})
+		}))
+	}
+}
+
 func WithEngineMutator(f func(*gin.Engine)) Option {
 	return func(s *Server) { s.engineMutators = append(s.engineMutators, f) }
 }
@@ -19,3 +34,41 @@ func WithBeforeStop(h func(*gin.Engine)) Option {
 func WithTokenValidator(v TokenValidator) Option {
 	return func(s *Server) { s.tokenValidator = v }
 }
+func WithTokenStore(ts TokenStore) Option {
+	return func(s *Server) { s.tokenStore = ts }
+}
+
+// WithOAuthEndpoints — подключить /oauth/revoke и /oauth/introspect,
+// работающие поверх TokenValidator и TokenStore сервера; introspectors —
+// client_id, которым разрешена интроспекция (см. OAuthEndpoints.IntrospectClients).
+func WithOAuthEndpoints(clients ClientAuthenticator, introspectors ...string) Option {
+	return func(s *Server) {
+		s.oauthClients = clients
+		s.introspectors = introspectors
+	}
+}
+
+// WithKeyring — публиковать ключи подписи и ротировать их, пока сервер запущен.
+func WithKeyring(k *Keyring) Option {
+	return func(s *Server) { s.keyring = k }
+}
+
+// WithDynamicOrigins — CORS (политика по умолчанию) дополнительно пускает
+// origin'ы из d; периодическая перезагрузка живёт, пока сервер запущен.
+func WithDynamicOrigins(d *DynamicOrigins) Option {
+	return func(s *Server) { s.dynOrigins = d }
+}
+func WithImpersonator(i Impersonator) Option {
+	return func(s *Server) { s.impersonator = i }
+}
+
+// WithLimiterStore — общее хранилище счётчиков RateLimitConfig (по умолчанию — в памяти).
+func WithLimiterStore(st LimiterStore) Option {
+	return func(s *Server) { s.limiterStore = st }
+}
+
+// WithLogger — логгер сервера вместо JSON в LogConfig.ErrorFile: им пишут
+// мидлвары (паники, c.Error), служебные сообщения и server.Logger(c).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) { s.logger = l }
+}
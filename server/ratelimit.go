@@ -0,0 +1,271 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey — из чего строится ключ лимита (RateLimitRule.By).
+type RateLimitKey string
+
+const (
+	RateByIP      RateLimitKey = "ip"
+	RateBySubject RateLimitKey = "sub"     // sub из access_claims; анонимные — по IP
+	RateByAPIKey  RateLimitKey = "api_key" // без ключа — по IP
+	RateByRoute   RateLimitKey = "route"   // метод + шаблон пути
+	RateByTenant  RateLimitKey = "tenant"  // tenant запроса; без tenant'а — по IP
+)
+
+// Алгоритмы RateLimitRule.Algorithm.
+const (
+	RateTokenBucket   = "token_bucket"
+	RateSlidingWindow = "sliding_window"
+)
+
+// rateLimiter — правила RateLimitConfig и лимиты TenantSettings поверх LimiterStore.
+type rateLimiter struct {
+	rules    []rateRule
+	store    LimiterStore
+	headers  bool
+	basePath string
+	tenants  *tenants
+}
+
+type rateRule struct {
+	RateLimitRule
+	limit  RateLimit
+	routes routeTable[struct{}]
+	policy string // для RateLimit-Policy: "100;w=60"
+	// лимит берётся из TenantSettings tenant'а запроса (правило "tenant")
+	perTenant bool
+}
+
+func newRateLimiter(cfg RateLimitConfig, store LimiterStore, basePath string, tn *tenants) (*rateLimiter, error) {
+	if store == nil {
+		store = NewMemoryLimiterStore(cfg.Shards)
+	}
+	rl := &rateLimiter{store: store, headers: !cfg.DisableHeaders, basePath: strings.TrimRight(basePath, "/"), tenants: tn}
+	for i, r := range cfg.Rules {
+		if r.Name == "" {
+			r.Name = "rule" + strconv.Itoa(i+1)
+		}
+		if r.Limit <= 0 || r.Window <= 0 {
+			return nil, fmt.Errorf("ratelimit: rule %s: Limit and Window must be positive", r.Name)
+		}
+		if r.Algorithm == "" {
+			r.Algorithm = RateTokenBucket
+		}
+		if r.Algorithm != RateTokenBucket && r.Algorithm != RateSlidingWindow {
+			return nil, fmt.Errorf("ratelimit: rule %s: unknown algorithm %q", r.Name, r.Algorithm)
+		}
+		if len(r.By) == 0 {
+			r.By = []RateLimitKey{RateByIP}
+		}
+		for _, k := range r.By {
+			switch k {
+			case RateByIP, RateBySubject, RateByAPIKey, RateByRoute, RateByTenant:
+			default:
+				return nil, fmt.Errorf("ratelimit: rule %s: unknown key %q", r.Name, k)
+			}
+		}
+		if r.APIKeyHeader == "" {
+			r.APIKeyHeader = "X-API-Key"
+		}
+		rr := rateRule{
+			RateLimitRule: r,
+			limit:         RateLimit{Algorithm: r.Algorithm, Limit: r.Limit, Window: r.Window, Burst: r.Burst},
+		}
+		rr.policy = rulePolicy(rr.limit)
+		if len(r.Routes) > 0 {
+			m := make(map[string]struct{}, len(r.Routes))
+			for _, k := range r.Routes {
+				m[k] = struct{}{}
+			}
+			rr.routes = newRouteTable(m)
+		}
+		rl.rules = append(rl.rules, rr)
+	}
+	if tn != nil && len(tn.limits) > 0 {
+		rl.rules = append(rl.rules, rateRule{
+			RateLimitRule: RateLimitRule{Name: "tenant", By: []RateLimitKey{RateByTenant}},
+			perTenant:     true,
+		})
+	}
+	return rl, nil
+}
+
+// rateHit — правило, применимое к запросу, с его ключом и лимитом.
+type rateHit struct {
+	rule   *rateRule
+	key    string
+	limit  RateLimit
+	policy string
+}
+
+// Middleware — правила одной стадии. До auth (afterAuth=false, на движке — видит
+// и 401, и 404) идут правила без RateBySubject/RateByTenant; после
+// AccessMiddleware — остальные, им нужен sub или tenant из токена.
+// Сначала запрос проверяется по всем правилам (Peek) и только если пускают все —
+// квота списывается (Take): отказ по одному правилу не тратит токены других.
+// Ошибка хранилища не блокирует запрос (fail-open), а уходит в c.Error.
+// nil — у стадии нет правил.
+func (rl *rateLimiter) Middleware(afterAuth bool) gin.HandlerFunc {
+	var rules []*rateRule
+	for i := range rl.rules {
+		if rl.rules[i].afterAuth() == afterAuth {
+			rules = append(rules, &rl.rules[i])
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return func(c *gin.Context) {
+		if systemPath(rl.basePath, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		hits := make([]rateHit, 0, len(rules))
+		for _, r := range rules {
+			if h, ok := rl.hit(c, r); ok {
+				hits = append(hits, h)
+			}
+		}
+		if len(hits) == 0 {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		now := time.Now()
+		if rl.respond(c, hits, func(h rateHit) (RateResult, error) {
+			return rl.store.Peek(ctx, h.key, h.limit, now)
+		}, false) {
+			return
+		}
+		if rl.respond(c, hits, func(h rateHit) (RateResult, error) {
+			return rl.store.Take(ctx, h.key, h.limit, now)
+		}, true) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// respond — прогоняет hits через op; при отказе отвечает 429 и возвращает true.
+// Заголовки RateLimit-* выставляются по итоговому (commit) проходу или по отказу.
+func (rl *rateLimiter) respond(c *gin.Context, hits []rateHit, op func(rateHit) (RateResult, error), commit bool) bool {
+	var (
+		tightest *RateResult
+		policy   string
+		denied   *RateResult
+	)
+	for _, h := range hits {
+		res, err := op(h)
+		if err != nil {
+			if commit {
+				_ = c.Error(fmt.Errorf("ratelimit: %s: %w", h.rule.Name, err))
+			}
+			continue
+		}
+		if !res.Allowed && (denied == nil || res.RetryAfter > denied.RetryAfter) {
+			denied = &res
+		}
+		if tightest == nil || res.Remaining < tightest.Remaining {
+			tightest, policy = &res, h.policy
+		}
+	}
+	if denied == nil && !commit {
+		return false
+	}
+	if tightest != nil && rl.headers {
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.Reset)))
+		h.Set("RateLimit-Policy", policy)
+	}
+	if denied != nil {
+		c.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(denied.RetryAfter))))
+		RespondError(c, http.StatusTooManyRequests, "rate_limited", "too many requests", nil)
+		return true
+	}
+	return false
+}
+
+// hit — ключ и лимит правила для запроса; false — правило не применяется.
+func (rl *rateLimiter) hit(c *gin.Context, r *rateRule) (rateHit, bool) {
+	if !r.applies(c) {
+		return rateHit{}, false
+	}
+	if !r.perTenant {
+		return rateHit{rule: r, key: r.key(c), limit: r.limit, policy: r.policy}, true
+	}
+	id := Tenant(c)
+	l, ok := rl.tenants.limitFor(id)
+	if !ok {
+		return rateHit{}, false
+	}
+	return rateHit{rule: r, key: r.Name + "|tenant:" + id, limit: l, policy: rulePolicy(l)}, true
+}
+
+// afterAuth — ключ правила зависит от токена.
+func (r *rateRule) afterAuth() bool {
+	return slices.Contains(r.By, RateBySubject) || slices.Contains(r.By, RateByTenant)
+}
+
+func (r *rateRule) applies(c *gin.Context) bool {
+	if len(r.Routes) == 0 {
+		return true
+	}
+	_, ok := r.routes.lookup(c.Request.Method, c.FullPath())
+	return ok
+}
+
+// key — "<правило>|<часть>|<часть>"; API‑ключи в хранилище не попадают, только их хэш.
+func (r *rateRule) key(c *gin.Context) string {
+	parts := make([]string, 0, len(r.By)+1)
+	parts = append(parts, r.Name)
+	for _, k := range r.By {
+		switch k {
+		case RateByIP:
+			parts = append(parts, "ip:"+c.ClientIP())
+		case RateBySubject:
+			if sub := Subject(c); sub != "" {
+				parts = append(parts, "sub:"+sub)
+			} else {
+				parts = append(parts, "ip:"+c.ClientIP())
+			}
+		case RateByAPIKey:
+			if key := c.GetHeader(r.APIKeyHeader); key != "" {
+				sum := sha256.Sum256([]byte(key))
+				parts = append(parts, "key:"+hex.EncodeToString(sum[:12]))
+			} else {
+				parts = append(parts, "ip:"+c.ClientIP())
+			}
+		case RateByRoute:
+			parts = append(parts, "route:"+c.Request.Method+" "+c.FullPath())
+		case RateByTenant:
+			if id := Tenant(c); id != "" {
+				parts = append(parts, "tenant:"+id)
+			} else {
+				parts = append(parts, "ip:"+c.ClientIP())
+			}
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// rulePolicy — значение для RateLimit-Policy: "100;w=60".
+func rulePolicy(l RateLimit) string {
+	return fmt.Sprintf("%d;w=%d", l.Limit, int(math.Ceil(l.Window.Seconds())))
+}
+
+func ceilSeconds(d time.Duration) int { return int(math.Ceil(d.Seconds())) }
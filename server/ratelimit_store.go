@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit — параметры одного лимита для хранилища.
+type RateLimit struct {
+	Algorithm string // RateTokenBucket или RateSlidingWindow
+	Limit     int
+	Window    time.Duration
+	Burst     int // только token bucket
+}
+
+// RateResult — решение по одному запросу.
+type RateResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // через сколько квота восстановится полностью (окно закончится)
+	RetryAfter time.Duration // когда имеет смысл повторить, если !Allowed
+}
+
+// LimiterStore — хранилище счётчиков. Свою реализацию (Redis и т.п.) подключают
+// через WithLimiterStore, чтобы лимит был общим для всех реплик.
+// Peek — то же решение, что дал бы Take, но без расхода квоты: запрос сначала
+// проверяется по всем правилам и только потом списывается.
+type LimiterStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateResult, error)
+	Peek(ctx context.Context, key string, limit RateLimit, now time.Time) (RateResult, error)
+}
+
+// MemoryLimiterStore — счётчики в памяти процесса, шардированные по ключу.
+// Неактивные ключи вычищаются по ходу работы.
+type MemoryLimiterStore struct {
+	seed   maphash.Seed
+	shards []limiterShard
+}
+
+type limiterShard struct {
+	mu  sync.Mutex
+	m   map[string]*limiterEntry
+	ops int // Take'ов с последней чистки
+}
+
+type limiterEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	start     time.Time
+	prev, cur int
+
+	expires time.Time
+}
+
+const limiterSweepEvery = 1024
+
+func NewMemoryLimiterStore(shards int) *MemoryLimiterStore {
+	if shards <= 0 {
+		shards = 64
+	}
+	s := &MemoryLimiterStore{seed: maphash.MakeSeed(), shards: make([]limiterShard, shards)}
+	for i := range s.shards {
+		s.shards[i].m = map[string]*limiterEntry{}
+	}
+	return s
+}
+
+func (s *MemoryLimiterStore) Take(_ context.Context, key string, l RateLimit, now time.Time) (RateResult, error) {
+	return s.take(key, l, now, true), nil
+}
+
+func (s *MemoryLimiterStore) Peek(_ context.Context, key string, l RateLimit, now time.Time) (RateResult, error) {
+	return s.take(key, l, now, false), nil
+}
+
+func (s *MemoryLimiterStore) take(key string, l RateLimit, now time.Time, commit bool) RateResult {
+	sh := &s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.ops++; sh.ops >= limiterSweepEvery {
+		sh.ops = 0
+		for k, e := range sh.m {
+			if now.After(e.expires) {
+				delete(sh.m, k)
+			}
+		}
+	}
+	e := sh.m[key]
+	if !commit {
+		// считаем на копии — состояние ключа не меняется
+		var cp limiterEntry
+		if e != nil {
+			cp = *e
+		}
+		e = &cp
+	} else if e == nil {
+		e = &limiterEntry{}
+		sh.m[key] = e
+	}
+	var r RateResult
+	if l.Algorithm == RateSlidingWindow {
+		r = e.slidingWindow(l, now)
+	} else {
+		r = e.tokenBucket(l, now)
+	}
+	e.expires = now.Add(2 * l.Window)
+	return r
+}
+
+func (e *limiterEntry) tokenBucket(l RateLimit, now time.Time) RateResult {
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = float64(l.Limit)
+	}
+	rate := float64(l.Limit) / l.Window.Seconds() // токенов в секунду
+	if e.last.IsZero() {
+		e.tokens = burst
+	} else {
+		e.tokens = math.Min(burst, e.tokens+now.Sub(e.last).Seconds()*rate)
+	}
+	e.last = now
+
+	r := RateResult{Limit: int(burst)}
+	if e.tokens >= 1 {
+		e.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = seconds((1 - e.tokens) / rate)
+	}
+	r.Remaining = int(e.tokens)
+	r.Reset = seconds((burst - e.tokens) / rate)
+	return r
+}
+
+// slidingWindow — счётчик скользящего окна: предыдущее окно учитывается
+// пропорционально тому, какая его часть ещё попадает в окно [now-Window, now].
+func (e *limiterEntry) slidingWindow(l RateLimit, now time.Time) RateResult {
+	w := l.Window
+	start := now.Truncate(w)
+	switch {
+	case e.start.Equal(start):
+	case e.start.Add(w).Equal(start):
+		e.prev, e.cur = e.cur, 0
+	default:
+		e.prev, e.cur = 0, 0
+	}
+	e.start = start
+
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/w.Seconds()
+	used := float64(e.prev)*weight + float64(e.cur)
+
+	r := RateResult{Limit: l.Limit, Reset: w - elapsed}
+	if used+1 <= float64(l.Limit) {
+		e.cur++
+		r.Allowed = true
+		used++
+	} else if e.cur+1 > l.Limit || e.prev == 0 {
+		r.RetryAfter = w - elapsed
+	} else {
+		// вклад prev уменьшается линейно: ждём, пока освободится одно место
+		free := 1 - (float64(l.Limit) - used)
+		r.RetryAfter = seconds(free / float64(e.prev) * w.Seconds())
+	}
+	r.Remaining = max(0, l.Limit-int(math.Ceil(used)))
+	return r
+}
+
+func seconds(f float64) time.Duration { return time.Duration(f * float64(time.Second)) }
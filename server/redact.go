@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RedactMask — чем заменяются значения по умолчанию (RedactConfig.Mask).
+const RedactMask = "[REDACTED]"
+
+// redactor — маскирует секреты в логах: заголовки, cookies, query‑параметры,
+// поля JSON и то же самое внутри произвольного текста (ошибки, паники).
+type redactor struct {
+	mask    string
+	headers map[string]bool // в нижнем регистре
+	cookies map[string]bool
+	keys    map[string]bool // query‑параметры и поля JSON
+	text    []*regexp.Regexp
+}
+
+// defaultRedactHeaders и т.д. — что маскируется, если RedactConfig.DisableDefaults=false;
+// к ним добавляются имена из AuthConfig (AuthHeader, AccessCookie, RefreshCookie)
+// и APIKeyHeader правил RateLimitConfig.
+var (
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"}
+	defaultRedactKeys    = []string{
+		"access_token", "refresh_token", "id_token", "token", "client_secret",
+		"password", "secret", "api_key", "code_verifier",
+	}
+)
+
+func newRedactor(cfg RedactConfig, auth AuthConfig, rate RateLimitConfig) *redactor {
+	r := &redactor{mask: cfg.Mask, headers: map[string]bool{}, cookies: map[string]bool{}, keys: map[string]bool{}}
+	if r.mask == "" {
+		r.mask = RedactMask
+	}
+	add := func(set map[string]bool, names ...string) {
+		for _, n := range names {
+			if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+				set[n] = true
+			}
+		}
+	}
+	if !cfg.DisableDefaults {
+		add(r.headers, defaultRedactHeaders...)
+		add(r.headers, auth.AuthHeader)
+		for _, rule := range rate.Rules {
+			add(r.headers, rule.APIKeyHeader)
+		}
+		add(r.cookies, auth.AccessCookie, auth.RefreshCookie)
+		add(r.keys, defaultRedactKeys...)
+		add(r.keys, auth.AccessCookie, auth.RefreshCookie)
+	}
+	add(r.headers, cfg.Headers...)
+	add(r.cookies, cfg.Cookies...)
+	add(r.keys, cfg.Query...)
+	add(r.keys, cfg.Fields...)
+
+	// в тексте: "Bearer xxx", name=value / name: value / "name":"value"
+	r.text = append(r.text, regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`))
+	var names []string
+	for _, set := range []map[string]bool{r.headers, r.cookies, r.keys} {
+		for n := range set {
+			names = append(names, regexp.QuoteMeta(n))
+		}
+	}
+	if len(names) > 0 {
+		r.text = append(r.text, regexp.MustCompile(
+			`(?i)(["']?\b(?:`+strings.Join(names, "|")+`)["']?\s*[:=]\s*)((?:(?:bearer|basic)\s+)?`+regexp.QuoteMeta(r.mask)+`|"[^"]*"|[^\s&;,"'}\]]+)`))
+	}
+	return r
+}
+
+// defaultRedactor — для RecoveryJSON/ErrorCapture без конфигурации сервера.
+func defaultRedactor() *redactor {
+	return newRedactor(RedactConfig{}, AuthConfig{}, RateLimitConfig{})
+}
+
+// String — маскирует секреты в свободном тексте.
+func (r *redactor) String(s string) string {
+	if s == "" {
+		return s
+	}
+	s = r.text[0].ReplaceAllStringFunc(s, func(m string) string {
+		scheme, _, _ := strings.Cut(m, " ")
+		return scheme + " " + r.mask
+	})
+	if len(r.text) > 1 {
+		s = r.text[1].ReplaceAllStringFunc(s, func(m string) string {
+			sub := r.text[1].FindStringSubmatch(m)
+			if strings.HasSuffix(strings.Trim(sub[2], `"`), r.mask) {
+				return m // уже замаскировано
+			}
+			if strings.HasPrefix(sub[2], `"`) {
+				return sub[1] + `"` + r.mask + `"`
+			}
+			return sub[1] + r.mask
+		})
+	}
+	return s
+}
+
+// Header — копия h с замаскированными заголовками; в Cookie/Set-Cookie
+// маскируются только значения cookies из списка.
+func (r *redactor) Header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, vs := range h {
+		lk := strings.ToLower(k)
+		cp := make([]string, len(vs))
+		for i, v := range vs {
+			switch {
+			case (lk == "cookie" || lk == "set-cookie") && len(r.cookies) > 0:
+				cp[i] = r.cookieHeader(v)
+			case r.headers[lk]:
+				cp[i] = r.mask
+			default:
+				cp[i] = r.String(v)
+			}
+		}
+		out[k] = cp
+	}
+	return out
+}
+
+func (r *redactor) cookieHeader(v string) string {
+	parts := strings.Split(v, ";")
+	for i, p := range parts {
+		name, _, ok := strings.Cut(p, "=")
+		if ok && r.cookies[strings.ToLower(strings.TrimSpace(name))] {
+			parts[i] = name + "=" + r.mask
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Query — RawQuery с замаскированными параметрами (порядок сохраняется).
+func (r *redactor) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	parts := strings.Split(raw, "&")
+	for i, p := range parts {
+		k, _, _ := strings.Cut(p, "=")
+		if name, err := url.QueryUnescape(k); err == nil && r.keys[strings.ToLower(name)] {
+			parts[i] = k + "=" + r.mask
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// JSON — тело с замаскированными полями (на любой глубине); не JSON — как текст.
+func (r *redactor) JSON(body []byte) []byte {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []byte(r.String(string(body)))
+	}
+	out, err := json.Marshal(r.value(v))
+	if err != nil {
+		return []byte(r.String(string(body)))
+	}
+	return out
+}
+
+// JSONPrefix — обрезанный JSON (capture): целиком не разбирается, а регулярка
+// не видит незакрытое значение. Оставляем начало до первого чувствительного ключа
+// или до места, где разбор сломался; отрезанное заменяет mask.
+func (r *redactor) JSONPrefix(body []byte) []byte {
+	type frame struct{ object, wantKey bool }
+	var stack []frame
+	dec := json.NewDecoder(bytes.NewReader(body))
+	cut := len(body)
+	for {
+		off := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			// конец данных посреди токена — в нём не может быть значения ключа
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				cut = off
+			}
+			break
+		}
+		if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].wantKey {
+			if key, ok := tok.(string); ok {
+				if r.sensitive(key) {
+					cut = off
+					break
+				}
+				stack[n-1].wantKey = false
+				continue
+			}
+		} else if n > 0 && stack[n-1].object {
+			stack[n-1].wantKey = true // значение прочитано (или начато) — дальше ключ
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, frame{object: true, wantKey: true})
+		case json.Delim('['):
+			stack = append(stack, frame{})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+	}
+	out := []byte(r.String(strings.ToValidUTF8(string(body[:cut]), "")))
+	if cut < len(body) {
+		out = append(out, r.mask...)
+	}
+	return out
+}
+
+// value — обход map/slice; ключи из списков маскируются целиком.
+func (r *redactor) value(v any) any {
+	switch x := v.(type) {
+	case string:
+		return r.String(x)
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			if r.sensitive(k) {
+				out[k] = r.mask
+			} else {
+				out[k] = r.value(e)
+			}
+		}
+		return out
+	case gin.H:
+		return r.value(map[string]any(x))
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = r.value(e)
+		}
+		return out
+	case http.Header:
+		return r.Header(x)
+	case url.Values:
+		out := make(url.Values, len(x))
+		for k, vs := range x {
+			if r.sensitive(k) {
+				out[k] = []string{r.mask}
+			} else {
+				out[k] = vs
+			}
+		}
+		return out
+	case error:
+		return r.String(x.Error())
+	}
+	return v
+}
+
+func (r *redactor) sensitive(key string) bool {
+	k := strings.ToLower(key)
+	return r.keys[k] || r.headers[k] || r.cookies[k]
+}
+
+// attr — маскирует атрибут записи slog (по ключу или по значению).
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	if r.sensitive(a.Key) {
+		return slog.String(a.Key, r.mask)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.String(a.Value.String()))
+	case slog.KindAny:
+		return slog.Any(a.Key, r.value(a.Value.Any()))
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		out := make([]slog.Attr, len(attrs))
+		for i, g := range attrs {
+			out[i] = r.attr(g)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	}
+	return a
+}
+
+// handler — обёртка slog.Handler: всё, что пишется через неё, проходит redactor.
+func (r *redactor) handler(h slog.Handler) slog.Handler {
+	if rh, ok := h.(*redactHandler); ok && rh.r == r {
+		return h
+	}
+	return &redactHandler{next: h, r: r}
+}
+
+type redactHandler struct {
+	next slog.Handler
+	r    *redactor
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, h.r.String(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.r.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = h.r.attr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(out), r: h.r}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), r: h.r}
+}
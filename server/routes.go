@@ -0,0 +1,162 @@
+package server
+
+import (
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes — группа роутов сервера и их настройки, которые не выражаются
+// хендлером gin: CORS‑политики, timeout'ы и лимиты тела групп/роутов.
+// Всё записывается при регистрации в таблицы сервера — с теми же ключами,
+// что TimeoutConfig.Routes и LimitsConfig.Routes, и с приоритетом над ними.
+type Routes struct {
+	*gin.RouterGroup
+	set  *routeSettings
+	auth *Auth
+}
+
+// routeSettings — настройки роутов одного сервера, собранные через Routes.
+type routeSettings struct {
+	timeouts   map[string]time.Duration
+	bodyLimits map[string]int64
+	// CORS: полный путь -> политика; prefixes — путь группы без "/" на конце
+	corsExact, corsPrefixes map[string]string
+}
+
+func newRouteSettings() *routeSettings {
+	return &routeSettings{
+		timeouts:     map[string]time.Duration{},
+		bodyLimits:   map[string]int64{},
+		corsExact:    map[string]string{},
+		corsPrefixes: map[string]string{},
+	}
+}
+
+// RoutesRegistrar — регистратор, которому нужны настройки роутов (WithRoutes).
+type RoutesRegistrar interface {
+	RegisterRoutes(r *Routes)
+}
+
+// RoutesFunc — функция как RoutesRegistrar.
+type RoutesFunc func(r *Routes)
+
+func (f RoutesFunc) RegisterRoutes(r *Routes) { f(r) }
+
+// Group — вложенная группа с теми же настройками сервера.
+func (r *Routes) Group(relativePath string, handlers ...gin.HandlerFunc) *Routes {
+	return &Routes{RouterGroup: r.RouterGroup.Group(relativePath, handlers...), set: r.set, auth: r.auth}
+}
+
+// AccessMiddleware/RefreshMiddleware — мидлвары Auth сервера (его TokenStore,
+// аудит, tenant'ы) для роутов, которые защищаются выборочно.
+func (r *Routes) AccessMiddleware() gin.HandlerFunc  { return r.auth.AccessMiddleware() }
+func (r *Routes) RefreshMiddleware() gin.HandlerFunc { return r.auth.RefreshMiddleware() }
+
+// Timeout — timeout всех роутов группы (и вложенных); TimeoutDisabled — без
+// timeout'а (стриминг: Flush/Hijack работают).
+func (r *Routes) Timeout(d time.Duration) {
+	for _, key := range r.groupKeys() {
+		r.set.timeouts[key] = d
+	}
+}
+
+// RouteTimeout — timeout одного роута; method "" — любой метод.
+//
+//	r.GET("/export", exportHandler)
+//	r.RouteTimeout(http.MethodGet, "/export", time.Minute)
+func (r *Routes) RouteTimeout(method, path string, d time.Duration) {
+	r.set.timeouts[r.routeKey(method, path)] = d
+}
+
+// BodyLimit — лимит тела всех роутов группы; BodyUnlimited — без лимита.
+func (r *Routes) BodyLimit(n int64) {
+	for _, key := range r.groupKeys() {
+		r.set.bodyLimits[key] = n
+	}
+}
+
+// RouteBodyLimit — лимит тела одного роута; method "" — любой метод.
+func (r *Routes) RouteBodyLimit(method, path string, n int64) {
+	r.set.bodyLimits[r.routeKey(method, path)] = n
+}
+
+// groupKeys — сама группа и всё под ней: "/base" и "/base/*".
+func (r *Routes) groupKeys() []string {
+	prefix := strings.TrimSuffix(r.BasePath(), "/")
+	if prefix == "" {
+		return []string{"/*"}
+	}
+	return []string{prefix, prefix + "/*"}
+}
+
+func (r *Routes) routeKey(method, path string) string {
+	return strings.TrimSpace(strings.ToUpper(method) + " " + joinRoutePath(r.BasePath(), path))
+}
+
+// mergeRoutes — таблица конфига, поверх — записанное через Routes.
+func mergeRoutes[T any](cfg, code map[string]T) map[string]T {
+	out := maps.Clone(cfg)
+	if out == nil {
+		out = make(map[string]T, len(code))
+	}
+	maps.Copy(out, code)
+	return out
+}
+
+// routeTable — значения по шаблону роута из конфига: "GET /api/v1/x" (метод + путь),
+// "/api/v1/x" (любой метод) и "/api/v1/group/*" (группа, самый длинный префикс).
+type routeTable[T any] struct {
+	exact    map[string]T // "GET /path" или " /path"
+	prefixes []routePrefix[T]
+}
+
+type routePrefix[T any] struct {
+	method, prefix string
+	v              T
+}
+
+func newRouteTable[T any](routes map[string]T) routeTable[T] {
+	t := routeTable[T]{exact: make(map[string]T, len(routes))}
+	for key, v := range routes {
+		method, path := splitRouteKey(key)
+		if prefix, ok := strings.CutSuffix(path, "/*"); ok {
+			t.prefixes = append(t.prefixes, routePrefix[T]{method, prefix + "/", v})
+			continue
+		}
+		t.exact[method+" "+path] = v
+	}
+	sort.Slice(t.prefixes, func(i, j int) bool { return len(t.prefixes[i].prefix) > len(t.prefixes[j].prefix) })
+	return t
+}
+
+// lookup — значение для метода и шаблона пути (c.FullPath()).
+func (t routeTable[T]) lookup(method, fullPath string) (T, bool) {
+	if fullPath != "" {
+		if v, ok := t.exact[method+" "+fullPath]; ok {
+			return v, true
+		}
+		if v, ok := t.exact[" "+fullPath]; ok {
+			return v, true
+		}
+		for _, p := range t.prefixes {
+			if (p.method == "" || p.method == method) && strings.HasPrefix(fullPath, p.prefix) {
+				return p.v, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// splitRouteKey — "GET /a" -> ("GET", "/a"), "/a" -> ("", "/a").
+func splitRouteKey(key string) (string, string) {
+	key = strings.TrimSpace(key)
+	if m, p, ok := strings.Cut(key, " "); ok {
+		return strings.ToUpper(m), strings.TrimSpace(p)
+	}
+	return "", key
+}
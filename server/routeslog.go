@@ -8,13 +8,27 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func LogRoutes(r *gin.Engine) {
-	type row struct{ Method, Path, Handler string }
+func LogRoutes(r *gin.Engine) { printRoutes(r, nil) }
+
+// LogRoutes — таблица роутов с эффективным timeout'ом.
+func (s *Server) LogRoutes() {
+	printRoutes(s.engine, func(method, path string) string {
+		return formatTimeout(s.timeouts.Effective(method, path))
+	})
+}
+
+// printRoutes — timeout == nil: без колонки TIMEOUT.
+func printRoutes(r *gin.Engine, timeout func(method, path string) string) {
+	type row struct{ Method, Path, Handler, Timeout string }
 
 	group := map[string][]row{}
 	for _, rt := range r.Routes() {
 		key := first(rt.Path)
-		group[key] = append(group[key], row{rt.Method, rt.Path, short(rt.Handler)})
+		t := ""
+		if timeout != nil {
+			t = timeout(rt.Method, rt.Path)
+		}
+		group[key] = append(group[key], row{rt.Method, rt.Path, short(rt.Handler), t})
 	}
 	gKeys := make([]string, 0, len(group))
 	for k := range group {
@@ -28,9 +42,13 @@ func LogRoutes(r *gin.Engine) {
 		wM = 6
 		wP = 60
 		wH = 36
+		wT = 8
 	)
 	sep := " │ "
 	lineW := 1 + wM + len(sep) + wP + len(sep) + wH
+	if timeout != nil {
+		lineW += len(sep) + wT
+	}
 
 	borderH := "├" + strings.Repeat("─", lineW-1)
 	top := "┌" + strings.Repeat("─", lineW-1)
@@ -43,7 +61,11 @@ func LogRoutes(r *gin.Engine) {
 	mCol := crop("METHOD", wM)
 	pCol := crop("PATH", wP)
 	hCol := crop("HANDLER", wH)
-	out.WriteString(fmt.Sprintf("│%-*s%s%-*s%s%-*s\n", wM, mCol, sep, wP, pCol, sep, wH, hCol))
+	out.WriteString(fmt.Sprintf("│%-*s%s%-*s%s%-*s", wM, mCol, sep, wP, pCol, sep, wH, hCol))
+	if timeout != nil {
+		out.WriteString(fmt.Sprintf("%s%-*s", sep, wT, "TIMEOUT"))
+	}
+	out.WriteString("\n")
 	out.WriteString(borderH + "\n")
 
 	for gi, g := range gKeys {
@@ -60,8 +82,12 @@ func LogRoutes(r *gin.Engine) {
 			hCol := crop(rw.Handler, wH)
 			mCol = color(rw.Method) + fmt.Sprintf("%-*s", wM, mCol) + reset
 
-			out.WriteString(fmt.Sprintf("│%s%s%-*s%s%-*s\n",
+			out.WriteString(fmt.Sprintf("│%s%s%-*s%s%-*s",
 				mCol, sep, wP, pCol, sep, wH, hCol))
+			if timeout != nil {
+				out.WriteString(fmt.Sprintf("%s%-*s", sep, wT, crop(rw.Timeout, wT)))
+			}
+			out.WriteString("\n")
 		}
 		if gi < len(gKeys)-1 {
 			out.WriteString(borderH + "\n")
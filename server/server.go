@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,16 +22,37 @@ type Server struct {
 	root       *gin.RouterGroup
 	httpServer *http.Server
 
-	accessOut io.WriteCloser
-	errorOut  io.WriteCloser
+	accessOut  io.WriteCloser
+	errorOut   io.WriteCloser
+	auditOut   io.WriteCloser
+	captureOut io.WriteCloser // nil — захват выключен
 
 	beforeStart    []func(*gin.Engine) error
 	beforeStop     []func(*gin.Engine)
 	routeRegs      []RouteRegistrar
+	routeSet       *routeSettings // Routes.CORSPolicy, Timeout, BodyLimit...
 	engineMutators []func(*gin.Engine)
 
 	tokenValidator TokenValidator
+	impersonator   Impersonator
+	tokenStore     TokenStore
+	oauthClients   ClientAuthenticator
+	introspectors  []string
+	keyring        *Keyring
+	dynOrigins     *DynamicOrigins
+	limiterStore   LimiterStore
+	logger         *slog.Logger
+	redactor       *redactor
+	levels         *logLevels
+	access         *accessLogger
+	capture        *capturer
+	audit          *auditLogger
 	auth           *Auth
+	tenants        *tenants
+	cors           *corsRouter
+	timeouts       *timeoutRouter
+	limits         *limits
+	concurrency    *concurrencyLimiter
 
 	startTime time.Time
 }
@@ -58,34 +81,178 @@ func New(cfg Config, opts ...Option) (*Server, error) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	s := &Server{cfg: cfg, startTime: time.Now()}
+	s := &Server{cfg: cfg, startTime: time.Now(), routeSet: newRouteSettings()}
+
+	// применяем опции (до сборки движка: они могут влиять на мидлвары)
+	for _, o := range opts {
+		o(s)
+	}
 
 	var err error
-	s.accessOut, err = newRotatingWriter(cfg.Log.AccessFile, cfg.Log.RotateMaxSizeBytes, cfg.Log.RotateBackups)
+	s.accessOut, err = newRotatingWriter(cfg.Log.AccessFile, cfg.Log)
 	if err != nil {
 		return nil, err
 	}
 	if cfg.Log.AccessFile == "" {
 		s.accessOut = nopCloser{Writer: os.Stdout}
+		if len(cfg.Log.AccessSinks) > 0 {
+			s.accessOut = nil // только sinks
+		}
+	}
+	if s.accessOut, err = withSinks("access", s.accessOut, cfg.Log.AccessSinks, cfg.Log); err != nil {
+		return nil, err
 	}
 
-	s.errorOut, err = newRotatingWriter(cfg.Log.ErrorFile, cfg.Log.RotateMaxSizeBytes, cfg.Log.RotateBackups)
+	s.errorOut, err = newRotatingWriter(cfg.Log.ErrorFile, cfg.Log)
 	if err != nil {
 		return nil, err
 	}
 	if cfg.Log.ErrorFile == "" {
 		s.errorOut = nopCloser{Writer: os.Stderr}
+		if len(cfg.Log.ErrorSinks) > 0 {
+			s.errorOut = nil
+		}
+	}
+	if s.errorOut, err = withSinks("error", s.errorOut, cfg.Log.ErrorSinks, cfg.Log); err != nil {
+		return nil, err
+	}
+	if s.logger == nil {
+		if s.logger, err = newServerLogger(s.errorOut, cfg.Log); err != nil {
+			return nil, err
+		}
+	}
+	// уровни и маскирование — и для логгера из WithLogger
+	if s.levels, err = newLogLevels(cfg.Log); err != nil {
+		return nil, err
+	}
+	s.redactor = newRedactor(cfg.Log.Redact, cfg.Auth, cfg.RateLimit)
+	s.logger = slog.New(s.levels.handler("", s.redactor.handler(s.logger.Handler())))
+
+	// cors: в Release ошибки конфигурации фатальны, иначе — предупреждения
+	var corsErrs []error
+	cfg.CORS, corsErrs = ValidateCORS(cfg.CORS)
+	if len(cfg.CORSPolicies) > 0 {
+		policies := make(map[string]CORSConfig, len(cfg.CORSPolicies))
+		for name, pc := range cfg.CORSPolicies {
+			var errs []error
+			policies[name], errs = ValidateCORS(pc)
+			for _, e := range errs {
+				corsErrs = append(corsErrs, fmt.Errorf("policy %s: %w", name, e))
+			}
+		}
+		cfg.CORSPolicies = policies
+	}
+	if len(cfg.Tenant.Tenants) > 0 {
+		tenantsCopy := make(map[string]TenantSettings, len(cfg.Tenant.Tenants))
+		for id, ts := range cfg.Tenant.Tenants {
+			origins, errs := normalizeOrigins(ts.AllowedOrigins)
+			for _, e := range errs {
+				corsErrs = append(corsErrs, fmt.Errorf("tenant %s: %w", id, e))
+			}
+			ts.AllowedOrigins = origins
+			tenantsCopy[id] = ts
+		}
+		cfg.Tenant.Tenants = tenantsCopy
+	}
+	if s.dynOrigins != nil && cfg.CORS.AllowCredentials {
+		// "*" из динамического источника отражал бы любой origin вместе с credentials
+		if err := s.dynOrigins.forbidWildcard(); err != nil {
+			corsErrs = append(corsErrs, fmt.Errorf("dynamic origins: %w", err))
+		}
+	}
+	if len(corsErrs) > 0 {
+		if cfg.Release {
+			return nil, errors.Join(corsErrs...)
+		}
+		for _, e := range corsErrs {
+			s.logger.Warn("invalid cors config", "module", "cors", "error", e)
+		}
+	}
+	if s.dynOrigins != nil {
+		cfg.CORS.AllowOriginFunc = anyOriginFunc(cfg.CORS.AllowOriginFunc, s.dynOrigins.Allow)
+		s.beforeStart = append(s.beforeStart, func(*gin.Engine) error {
+			s.dynOrigins.Start(func(err error) {
+				s.logger.Error("origins reload failed", "module", "cors", "error", err)
+			})
+			return nil
+		})
+		s.beforeStop = append(s.beforeStop, func(*gin.Engine) { s.dynOrigins.Stop() })
+	}
+
+	// аудит не смешивается с логом сервера: своя ротация, хранение и проверка цепочки;
+	// включается только явно — AuditFile или AuditSinks
+	if cfg.Log.AuditFile != "" || len(cfg.Log.AuditSinks) > 0 {
+		if cfg.Log.AuditFile != "" {
+			if s.auditOut, err = newRotatingWriter(cfg.Log.AuditFile, cfg.Log); err != nil {
+				return nil, err
+			}
+		}
+		if s.auditOut, err = withSinks("audit", s.auditOut, cfg.Log.AuditSinks, cfg.Log); err != nil {
+			return nil, err
+		}
+		s.audit, err = newAuditLogger(s.auditOut, cfg.Log.AuditFile, cfg.Log.Audit, s.redactor, func(err error) {
+			s.logger.Error("audit failed", "module", "audit", "error", err)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.cfg = cfg
+
+	if cfg.Capture.File != "" {
+		if s.captureOut, err = newRotatingWriter(cfg.Capture.File, cfg.Log); err != nil {
+			return nil, err
+		}
+		s.capture = newCapturer(s.captureOut, cfg.Capture, s.redactor, cfg.BasePath)
 	}
 
 	s.engine = gin.New()
-	s.engine.Use(gin.LoggerWithWriter(s.accessOut))
-	s.engine.Use(RecoveryJSON(s.errorOut))
-	s.engine.Use(ErrorCapture(s.errorOut))
+	if s.access, err = newAccessLogger(s.accessOut, cfg.Log, s.redactor, s.levels); err != nil {
+		return nil, err
+	}
+	s.engine.Use(s.access.Middleware())
+	s.engine.Use(RecoveryJSONWithLogger(s.logger))
+	s.engine.Use(ErrorCaptureWithLogger(s.logger))
 	s.engine.Use(RequestID("X-Request-Id"))
-	s.engine.Use(CORSMiddleware(cfg.CORS))
-	if cfg.PerRequest.RequestTimeout > 0 {
-		s.engine.Use(TimeoutMiddleware(cfg.PerRequest))
+	s.engine.Use(RequestLogger(s.logger))
+	if s.audit != nil {
+		s.engine.Use(s.audit.Middleware())
+	}
+	if s.capture != nil {
+		s.engine.Use(s.capture.Middleware())
+	}
+	if cfg.Tenant.enabled() {
+		if s.tenants, err = newTenants(cfg.Tenant, cfg.BasePath); err != nil {
+			return nil, err
+		}
+		s.engine.Use(s.tenants.Resolve())
+	}
+	s.cors = newCORSRouter(cfg.CORS, cfg.CORSPolicies, s.tenants)
+	s.engine.Use(s.cors.Middleware())
+	// отказы tenant'а и 429 — после CORS, чтобы браузер их увидел
+	if s.tenants != nil {
+		s.engine.Use(s.tenants.Middleware())
+	}
+	rl, err := newRateLimiter(cfg.RateLimit, s.limiterStore, cfg.BasePath, s.tenants)
+	if err != nil {
+		return nil, err
+	}
+	// правила без sub/tenant — до auth: ограничивают и перебор токенов (401), и 404
+	if h := rl.Middleware(false); h != nil {
+		s.engine.Use(h)
+	}
+	if cfg.Concurrency.Algorithm != "" {
+		if s.concurrency, err = newConcurrencyLimiter(cfg.Concurrency, cfg.BasePath); err != nil {
+			return nil, err
+		}
+		s.engine.Use(s.concurrency.Middleware())
 	}
+	// до timeout'ов: их буферный writer не даёт выставить дедлайн чтения тела
+	s.limits = newLimits(cfg.Limits)
+	s.engine.Use(s.limits.Middleware())
+	// ставим всегда: Routes.Timeout работает и без глобального timeout'а
+	s.timeouts = newTimeoutRouter(cfg.PerRequest)
+	s.engine.Use(s.timeouts.Middleware())
 
 	// 404/405
 	s.engine.NoRoute(NotFoundHandler)
@@ -98,19 +265,25 @@ func New(cfg Config, opts ...Option) (*Server, error) {
 		s.root = &s.engine.RouterGroup
 	}
 
-	// применяем опции
-	for _, o := range opts {
-		o(s)
-	}
-
 	// auth (по желанию)
 	if s.tokenValidator == nil {
 		s.tokenValidator = StubValidator{}
 	}
 	s.auth = newAuth(cfg.Auth, s.tokenValidator)
+	s.auth.impersonator = s.impersonator
+	s.auth.audit = s.audit
+	s.auth.tenants = s.tenants
+	if s.tenants != nil {
+		s.tenants.auth = s.auth
+	}
+	s.auth.store = s.tokenStore
 	if cfg.Auth.EnableAccessMiddleware {
 		s.root.Use(s.auth.AccessMiddleware())
 	}
+	// правила по sub/tenant — после auth: ключ берётся из токена
+	if h := rl.Middleware(true); h != nil {
+		s.root.Use(h)
+	}
 
 	// мутации движка (pprof/метрики/и т.д.)
 	for _, m := range s.engineMutators {
@@ -127,12 +300,57 @@ func New(cfg Config, opts ...Option) (*Server, error) {
 		rr.Register(s.root)
 	}
 
+	// oauth — на отдельной группе, без access мидлвара root
+	if s.oauthClients != nil {
+		if s.tokenStore == nil {
+			s.tokenStore = NewMemoryTokenStore()
+			s.auth.store = s.tokenStore
+		}
+		oa := &OAuthEndpoints{
+			Validator:         s.tokenValidator,
+			Store:             s.tokenStore,
+			Clients:           s.oauthClients,
+			IntrospectClients: s.introspectors,
+		}
+		oa.Register(s.engine.Group(cfg.BasePath))
+	}
+
+	// jwks/paserk — на корне движка, как положено /.well-known
+	if s.keyring != nil {
+		s.keyring.Register(&s.engine.RouterGroup)
+		s.beforeStart = append(s.beforeStart, func(*gin.Engine) error {
+			s.keyring.Start(func(err error) {
+				s.logger.Error("key rotation failed", "module", "keyring", "error", err)
+			})
+			return nil
+		})
+		s.beforeStop = append(s.beforeStop, func(*gin.Engine) { s.keyring.Stop() })
+	}
+
 	// ✅ системные эндпоинты регистрируем АВТОМАТИЧЕСКИ
 	SysEndpoints(s)
 
+	// cors политики групп/роутов известны только после регистрации
+	if unknown := s.cors.setRoutes(s.routeSet); len(unknown) > 0 {
+		err := fmt.Errorf("cors: unknown policies referenced by routes: %s", strings.Join(unknown, ", "))
+		if cfg.Release {
+			return nil, err
+		}
+		s.logger.Warn("default cors policy used", "module", "cors", "error", err)
+	}
+
+	// timeout'ы и лимиты тела, записанные регистраторами через Routes
+	s.timeouts.setRoutes(s.routeSet.timeouts)
+	s.limits.setRoutes(s.routeSet.bodyLimits)
+
+	var handler http.Handler = s.engine
+	if s.tenants != nil {
+		handler = s.tenants.Handler(handler)
+	}
+
 	s.httpServer = &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Addr),
-		Handler:           s.engine,
+		Handler:           handler,
 		ReadTimeout:       cfg.Timeouts.ReadTimeout,
 		ReadHeaderTimeout: cfg.Timeouts.ReadHeaderTimeout,
 		WriteTimeout:      cfg.Timeouts.WriteTimeout,
@@ -141,7 +359,7 @@ func New(cfg Config, opts ...Option) (*Server, error) {
 
 	// печать роутов при старте? (после SysEndpoints)
 	if cfg.PrintRoutes {
-		LogRoutes(s.engine)
+		s.LogRoutes()
 	}
 
 	return s, nil
@@ -149,6 +367,12 @@ func New(cfg Config, opts ...Option) (*Server, error) {
 
 func (s *Server) Engine() *gin.Engine    { return s.engine }
 func (s *Server) Root() *gin.RouterGroup { return s.root }
+func (s *Server) Logger() *slog.Logger   { return s.logger }
+
+// AccessMiddleware/RefreshMiddleware — мидлвары Auth сервера (его TokenStore,
+// аудит, tenant'ы) для роутов, добавленных после New; в регистраторах — Routes.
+func (s *Server) AccessMiddleware() gin.HandlerFunc  { return s.auth.AccessMiddleware() }
+func (s *Server) RefreshMiddleware() gin.HandlerFunc { return s.auth.RefreshMiddleware() }
 
 // Sugar
 func (s *Server) GET(path string, h ...gin.HandlerFunc)    { s.root.GET(path, h...) }
@@ -175,14 +399,49 @@ func (s *Server) Start() error {
 		_ = s.Shutdown(context.Background())
 	}()
 
-	log.New(s.errorOut, "[server] ", log.LstdFlags|log.Lmsgprefix).Printf("listening on %s", fmt.Sprintf(":%d", s.cfg.Addr))
+	// SIGHUP — переоткрыть логи (logrotate без copytruncate)
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		for range ch {
+			if err := s.ReopenLogs(); err != nil {
+				s.logger.Error("logs reopen failed", "error", err)
+				continue
+			}
+			s.logger.Info("logs reopened")
+		}
+	}()
+
+	s.logger.Info("listening", "addr", fmt.Sprintf(":%d", s.cfg.Addr))
 	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.New(s.errorOut, "[server] ", log.LstdFlags|log.Lmsgprefix).Printf("listen error: %v", err)
+		s.logger.Error("listen failed", "error", err)
 		return err
 	}
 	return nil
 }
 
+// LogSinkStats — счётчики доставки в LogConfig.*Sinks (для /sys/logs/sinks).
+func (s *Server) LogSinkStats() []LogSinkStats {
+	out := []LogSinkStats{}
+	for _, w := range []io.Writer{s.accessOut, s.errorOut, s.auditOut} {
+		if f, ok := w.(*fanoutWriter); ok {
+			out = append(out, f.Stats()...)
+		}
+	}
+	return out
+}
+
+// ReopenLogs — переоткрыть AccessFile/ErrorFile/AuditFile и Capture.File (SIGHUP, /sys/logs/reopen).
+func (s *Server) ReopenLogs() error {
+	var errs []error
+	for _, w := range []io.Writer{s.accessOut, s.errorOut, s.auditOut, s.captureOut} {
+		if r, ok := w.(reopener); ok {
+			errs = append(errs, r.Reopen())
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	for _, h := range s.beforeStop {
 		h(s.engine)
@@ -190,7 +449,17 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.ShutdownWait)
 	defer cancel()
 	err := s.httpServer.Shutdown(ctx)
+	// финальный checkpoint аудита — пока writer'ы (и ErrorFile для ошибки) открыты
+	if err := s.audit.Close(); err != nil {
+		s.logger.Error("audit checkpoint failed", "module", "audit", "error", err)
+	}
+	if s.auditOut != nil {
+		_ = s.auditOut.Close()
+	}
 	_ = s.accessOut.Close()
 	_ = s.errorOut.Close()
+	if s.captureOut != nil {
+		_ = s.captureOut.Close()
+	}
 	return err
 }
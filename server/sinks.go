@@ -0,0 +1,434 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Типы LogSink.
+const (
+	SinkStdout   = "stdout"
+	SinkStderr   = "stderr"
+	SinkFile     = "file"     // ещё один файл (с ротацией по LogConfig)
+	SinkSyslog   = "syslog"   // RFC 5424 по udp/tcp/unix/unixgram
+	SinkJournald = "journald" // нативный протокол systemd-journald
+)
+
+// DefaultJournaldSocket — сокет journald по умолчанию.
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// LogSink — дополнительный получатель лога (LogConfig.AccessSinks и т.д.).
+// Доставка асинхронная: при переполнении очереди записи отбрасываются
+// (счётчики — Server.LogSinkStats и GET /sys/logs/sinks), запрос не ждёт.
+type LogSink struct {
+	Type string // Sink*
+	// syslog: "udp", "tcp", "unix", "unixgram"; пусто — "unixgram" (или "udp", если Addr — host:port)
+	Network string
+	// syslog: "host:514" или путь сокета (по умолчанию /dev/log);
+	// journald: путь сокета (по умолчанию DefaultJournaldSocket); file: путь файла
+	Addr string
+	// syslog facility (0..23), по умолчанию 1 (user)
+	Facility int
+	// APP-NAME в syslog, SYSLOG_IDENTIFIER в journald; по умолчанию имя бинарника
+	AppName string
+	// очередь записей, по умолчанию 1024
+	Buffer int
+}
+
+// LogSinkStats — счётчики доставки одного sink'а.
+type LogSinkStats struct {
+	Stream  string `json:"stream"` // access, error, audit
+	Sink    string `json:"sink"`
+	Sent    int64  `json:"sent"`
+	Dropped int64  `json:"dropped"` // очередь переполнена
+	Failed  int64  `json:"failed"`  // ошибка отправки (запись потеряна)
+	Queued  int    `json:"queued"`
+}
+
+// logSender — синхронная отправка одной записи (строки лога без '\n').
+type logSender interface {
+	Send(line []byte) error
+	Close() error
+}
+
+// withSinks — primary (файл, может быть nil) плюс sinks; без sinks — сам primary.
+func withSinks(stream string, primary io.WriteCloser, sinks []LogSink, cfg LogConfig) (io.WriteCloser, error) {
+	if len(sinks) == 0 {
+		return primary, nil
+	}
+	f := &fanoutWriter{primary: primary}
+	for _, sc := range sinks {
+		snd, name, err := newLogSender(stream, sc, cfg)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("log: %s sink %q: %w", stream, sc.Type, err)
+		}
+		f.sinks = append(f.sinks, newAsyncSink(stream, name, snd, sc.Buffer))
+	}
+	return f, nil
+}
+
+func newLogSender(stream string, sc LogSink, cfg LogConfig) (logSender, string, error) {
+	switch sc.Type {
+	case SinkStdout:
+		return &writerSender{w: os.Stdout}, SinkStdout, nil
+	case SinkStderr:
+		return &writerSender{w: os.Stderr}, SinkStderr, nil
+	case SinkFile:
+		if sc.Addr == "" {
+			return nil, "", errors.New("file sink needs Addr")
+		}
+		w, err := newRotatingWriter(sc.Addr, cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		return &writerSender{w: w, c: w}, "file " + sc.Addr, nil
+	case SinkSyslog:
+		s := newSyslogSender(stream, sc)
+		return s, "syslog " + s.network + " " + s.addr, nil
+	case SinkJournald:
+		s := newJournaldSender(stream, sc)
+		return s, "journald " + s.addr, nil
+	}
+	return nil, "", fmt.Errorf("unknown type (%s, %s, %s, %s, %s)", SinkStdout, SinkStderr, SinkFile, SinkSyslog, SinkJournald)
+}
+
+// fanoutWriter — синхронно в primary, копия — в очереди sinks.
+type fanoutWriter struct {
+	primary io.WriteCloser
+	sinks   []*asyncSink
+}
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	for _, s := range f.sinks {
+		s.enqueue(p)
+	}
+	if f.primary == nil {
+		return len(p), nil
+	}
+	return f.primary.Write(p)
+}
+
+// Reopen — только primary: sinks не держат файлов (кроме SinkFile, у которого своя ротация).
+func (f *fanoutWriter) Reopen() error {
+	if r, ok := f.primary.(reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+func (f *fanoutWriter) Close() error {
+	var errs []error
+	for _, s := range f.sinks {
+		errs = append(errs, s.Close())
+	}
+	if f.primary != nil {
+		errs = append(errs, f.primary.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanoutWriter) Stats() []LogSinkStats {
+	out := make([]LogSinkStats, 0, len(f.sinks))
+	for _, s := range f.sinks {
+		out = append(out, s.Stats())
+	}
+	return out
+}
+
+// sinkCloseWait — сколько Close ждёт доставки очереди.
+var sinkCloseWait = 2 * time.Second
+
+// asyncSink — очередь и горутина доставки одного sink'а.
+type asyncSink struct {
+	stream, name string
+	snd          logSender
+	ch           chan []byte
+	abort        chan struct{} // Close не дождался очереди — остаток отбрасывается
+	done         chan struct{}
+	closeErr     error // snd.Close(); snd закрывает только run
+
+	mu     sync.RWMutex // закрытие vs enqueue
+	closed bool
+
+	sent, dropped, failed atomic.Int64
+}
+
+func newAsyncSink(stream, name string, snd logSender, size int) *asyncSink {
+	if size <= 0 {
+		size = 1024
+	}
+	s := &asyncSink{stream: stream, name: name, snd: snd, ch: make(chan []byte, size),
+		abort: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *asyncSink) enqueue(p []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- bytes.TrimSuffix(bytes.Clone(p), []byte("\n")):
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run — единственная горутина, которая трогает snd (Send и Close).
+func (s *asyncSink) run() {
+	defer close(s.done)
+	for line := range s.ch {
+		select {
+		case <-s.abort:
+			s.dropped.Add(1)
+			continue
+		default:
+		}
+		if err := s.snd.Send(line); err != nil {
+			s.failed.Add(1)
+			continue
+		}
+		s.sent.Add(1)
+	}
+	s.closeErr = s.snd.Close()
+}
+
+// Close — дослать очередь (не дольше sinkCloseWait, остальное — Dropped) и закрыть соединение.
+// Ждёт run: текущая отправка ограничена таймаутами sender'а.
+func (s *asyncSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.ch)
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+	case <-time.After(sinkCloseWait):
+		close(s.abort)
+		<-s.done
+	}
+	return s.closeErr
+}
+
+func (s *asyncSink) Stats() LogSinkStats {
+	return LogSinkStats{
+		Stream:  s.stream,
+		Sink:    s.name,
+		Sent:    s.sent.Load(),
+		Dropped: s.dropped.Load(),
+		Failed:  s.failed.Load(),
+		Queued:  len(s.ch),
+	}
+}
+
+// writerSender — stdout/stderr/файл: строка + '\n'.
+type writerSender struct {
+	w io.Writer
+	c io.Closer // nil — не закрывать (stdout)
+}
+
+func (s *writerSender) Send(line []byte) error {
+	_, err := s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (s *writerSender) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
+
+// Severity syslog/journald.
+const (
+	sevError  = 3
+	sevWarn   = 4
+	sevNotice = 5
+	sevInfo   = 6
+	sevDebug  = 7
+)
+
+// lineSeverity — уровень из записи slog (JSON "level":"WARN" или logfmt level=WARN);
+// без уровня (аудит) — def.
+func lineSeverity(line []byte, def int) int {
+	var lvl []byte
+	if i := bytes.Index(line, []byte(`"level":"`)); i >= 0 {
+		lvl = line[i+len(`"level":"`):]
+	} else if i := bytes.Index(line, []byte("level=")); i >= 0 && (i == 0 || line[i-1] == ' ') {
+		lvl = line[i+len("level="):]
+	} else {
+		return def
+	}
+	switch {
+	case bytes.HasPrefix(lvl, []byte("ERROR")):
+		return sevError
+	case bytes.HasPrefix(lvl, []byte("WARN")):
+		return sevWarn
+	case bytes.HasPrefix(lvl, []byte("INFO")):
+		return sevInfo
+	case bytes.HasPrefix(lvl, []byte("DEBUG")):
+		return sevDebug
+	}
+	return def
+}
+
+func defaultSeverity(stream string) int {
+	if stream == "audit" {
+		return sevNotice
+	}
+	return sevInfo
+}
+
+func appName(name string) string {
+	if name != "" {
+		return name
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// syslogSender — RFC 5424; tcp — octet counting (RFC 6587), unix — по строке,
+// udp/unixgram — датаграмма на запись. Соединение переустанавливается после ошибки.
+type syslogSender struct {
+	stream, network, addr string
+	facility              int
+	app, host, pid        string
+	conn                  net.Conn
+}
+
+func newSyslogSender(stream string, sc LogSink) *syslogSender {
+	s := &syslogSender{stream: stream, network: sc.Network, addr: sc.Addr, facility: sc.Facility, app: appName(sc.AppName)}
+	if s.addr == "" {
+		s.addr = "/dev/log"
+	}
+	if s.network == "" {
+		s.network = "unixgram"
+		if _, _, err := net.SplitHostPort(s.addr); err == nil {
+			s.network = "udp"
+		}
+	}
+	if s.facility <= 0 || s.facility > 23 {
+		s.facility = 1
+	}
+	s.host, _ = os.Hostname()
+	if s.host == "" {
+		s.host = "-"
+	}
+	s.pid = strconv.Itoa(os.Getpid())
+	return s
+}
+
+func (s *syslogSender) format(line []byte, now time.Time) []byte {
+	pri := s.facility*8 + lineSeverity(line, defaultSeverity(s.stream))
+	// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	return fmt.Appendf(nil, "<%d>1 %s %s %s %s %s - %s",
+		pri, now.UTC().Format("2006-01-02T15:04:05.000000Z"), s.host, s.app, s.pid, s.stream, line)
+}
+
+func (s *syslogSender) Send(line []byte) error {
+	if s.conn == nil {
+		c, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = c
+	}
+	msg := s.format(line, time.Now())
+	switch s.network {
+	case "tcp", "tcp4", "tcp6":
+		msg = append(strconv.AppendInt(nil, int64(len(msg)), 10), append([]byte{' '}, msg...)...)
+	case "unix":
+		msg = append(msg, '\n')
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := s.conn.Write(msg); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// journaldSender — датаграммы KEY=VALUE; многострочные значения — в бинарной форме
+// (KEY\n, длина uint64 LE, значение). Записи больше лимита датаграммы journald
+// принимает только через memfd — такие считаются Failed.
+type journaldSender struct {
+	stream, addr, app string
+	conn              *net.UnixConn
+}
+
+func newJournaldSender(stream string, sc LogSink) *journaldSender {
+	s := &journaldSender{stream: stream, addr: sc.Addr, app: appName(sc.AppName)}
+	if s.addr == "" {
+		s.addr = DefaultJournaldSocket
+	}
+	return s
+}
+
+func (s *journaldSender) format(line []byte) []byte {
+	var b bytes.Buffer
+	field := func(k string, v []byte) {
+		if bytes.IndexByte(v, '\n') < 0 {
+			b.WriteString(k)
+			b.WriteByte('=')
+			b.Write(v)
+			b.WriteByte('\n')
+			return
+		}
+		b.WriteString(k)
+		b.WriteByte('\n')
+		_ = binary.Write(&b, binary.LittleEndian, uint64(len(v)))
+		b.Write(v)
+		b.WriteByte('\n')
+	}
+	field("MESSAGE", line)
+	field("PRIORITY", strconv.AppendInt(nil, int64(lineSeverity(line, defaultSeverity(s.stream))), 10))
+	field("SYSLOG_IDENTIFIER", []byte(s.app))
+	field("LOG_STREAM", []byte(s.stream))
+	return b.Bytes()
+}
+
+func (s *journaldSender) Send(line []byte) error {
+	if s.conn == nil {
+		c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: s.addr, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		s.conn = c
+	}
+	if _, err := s.conn.Write(s.format(line)); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *journaldSender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
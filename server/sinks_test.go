@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// RFC 5424: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+var syslogRe = regexp.MustCompile(`^<(\d+)>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z \S+ (\S+) \d+ (\S+) - (.*)$`)
+
+func checkSyslog(t *testing.T, msg []byte, wantPRI int, wantApp, wantStream, wantMsg string) {
+	t.Helper()
+	m := syslogRe.FindSubmatch(msg)
+	if m == nil {
+		t.Fatalf("not RFC 5424: %q", msg)
+	}
+	if pri, _ := strconv.Atoi(string(m[1])); pri != wantPRI {
+		t.Errorf("PRI %d, want %d", pri, wantPRI)
+	}
+	if string(m[2]) != wantApp || string(m[3]) != wantStream || string(m[4]) != wantMsg {
+		t.Errorf("app=%q stream=%q msg=%q", m[2], m[3], m[4])
+	}
+}
+
+func sendAll(t *testing.T, snd logSender, lines ...string) {
+	t.Helper()
+	for _, l := range lines {
+		if err := snd.Send([]byte(l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	snd := newSyslogSender("error", LogSink{Addr: pc.LocalAddr().String(), Facility: 16, AppName: "api"})
+	defer snd.Close()
+	if snd.network != "udp" {
+		t.Fatalf("network %q, want udp for host:port", snd.network)
+	}
+	sendAll(t, snd, `{"level":"WARN","msg":"slow"}`)
+
+	buf := make([]byte, 64<<10)
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslog(t, buf[:n], 16*8+sevWarn, "api", "error", `{"level":"WARN","msg":"slow"}`)
+}
+
+// TestSyslogTCP — octet counting (RFC 6587 §3.4.1): "<len> <msg>" без разделителей.
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan [][]byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		var msgs [][]byte
+		for len(msgs) < 2 {
+			size, err := br.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, _ := strconv.Atoi(strings.TrimSuffix(size, " "))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(br, msg); err != nil {
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+		got <- msgs
+	}()
+
+	snd := newSyslogSender("audit", LogSink{Type: SinkSyslog, Network: "tcp", Addr: ln.Addr().String(), AppName: "api"})
+	defer snd.Close()
+	sendAll(t, snd, `{"seq":1}`, "line with\nnewline")
+
+	select {
+	case msgs := <-got:
+		if len(msgs) != 2 {
+			t.Fatalf("%d messages", len(msgs))
+		}
+		checkSyslog(t, msgs[0], 1*8+sevNotice, "api", "audit", `{"seq":1}`)
+		if !bytes.HasSuffix(msgs[1], []byte("line with\nnewline")) {
+			t.Fatalf("framing broke multi-line message: %q", msgs[1])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+// TestSyslogUnix — unix stream: запись на строку; unixgram — датаграмма на запись.
+func TestSyslogUnix(t *testing.T) {
+	dir := t.TempDir()
+
+	ln, err := net.Listen("unix", filepath.Join(dir, "stream.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 2)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		sc := bufio.NewScanner(c)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	snd := newSyslogSender("access", LogSink{Network: "unix", Addr: ln.Addr().String(), AppName: "api"})
+	defer snd.Close()
+	sendAll(t, snd, "level=INFO msg=a", "level=ERROR msg=b")
+	for _, want := range []struct {
+		sev int
+		msg string
+	}{{sevInfo, "level=INFO msg=a"}, {sevError, "level=ERROR msg=b"}} {
+		select {
+		case l := <-lines:
+			checkSyslog(t, []byte(l), 8+want.sev, "api", "access", want.msg)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	gram, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "dgram.sock"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gram.Close()
+	snd2 := newSyslogSender("access", LogSink{Addr: filepath.Join(dir, "dgram.sock"), AppName: "api"})
+	defer snd2.Close()
+	if snd2.network != "unixgram" {
+		t.Fatalf("network %q, want unixgram for a path", snd2.network)
+	}
+	sendAll(t, snd2, "plain")
+	buf := make([]byte, 64<<10)
+	_ = gram.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := gram.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslog(t, buf[:n], 8+sevInfo, "api", "access", "plain")
+}
+
+// parseJournald — разбор датаграммы нативного протокола journald.
+func parseJournald(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			t.Fatalf("unterminated field %q", b)
+		}
+		line := b[:nl]
+		b = b[nl+1:]
+		if k, v, ok := bytes.Cut(line, []byte("=")); ok {
+			out[string(k)] = string(v)
+			continue
+		}
+		// бинарная форма: KEY\n, uint64 LE длина, значение, \n
+		if len(b) < 8 {
+			t.Fatalf("short binary field %q", line)
+		}
+		n := binary.LittleEndian.Uint64(b[:8])
+		b = b[8:]
+		if uint64(len(b)) < n+1 || b[n] != '\n' {
+			t.Fatalf("bad binary field %q", line)
+		}
+		out[string(line)] = string(b[:n])
+		b = b[n+1:]
+	}
+	return out
+}
+
+func TestJournaldDatagram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	snd := newJournaldSender("error", LogSink{Addr: path, AppName: "api"})
+	defer snd.Close()
+
+	sendAll(t, snd, `{"level":"ERROR","msg":"boom"}`, "panic: x\ngoroutine 1")
+	buf := make([]byte, 64<<10)
+	for _, want := range []map[string]string{
+		{"MESSAGE": `{"level":"ERROR","msg":"boom"}`, "PRIORITY": "3", "SYSLOG_IDENTIFIER": "api", "LOG_STREAM": "error"},
+		{"MESSAGE": "panic: x\ngoroutine 1", "PRIORITY": "6", "SYSLOG_IDENTIFIER": "api", "LOG_STREAM": "error"},
+	} {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := parseJournald(t, buf[:n])
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+// blockingSender — Send ждёт release; считает гонки Send/Close.
+type blockingSender struct {
+	release chan struct{}
+	inSend  atomic.Bool
+	closed  atomic.Bool
+	raced   atomic.Bool
+	sent    atomic.Int64
+}
+
+func (b *blockingSender) Send([]byte) error {
+	b.inSend.Store(true)
+	defer b.inSend.Store(false)
+	if b.closed.Load() {
+		b.raced.Store(true)
+	}
+	<-b.release
+	b.sent.Add(1)
+	return nil
+}
+
+func (b *blockingSender) Close() error {
+	if b.inSend.Load() {
+		b.raced.Store(true)
+	}
+	b.closed.Store(true)
+	return nil
+}
+
+// TestAsyncSinkCloseWaitsForSend — Close не закрывает sender, пока идёт Send;
+// недосланный после sinkCloseWait остаток считается Dropped.
+func TestAsyncSinkCloseWaitsForSend(t *testing.T) {
+	defer func(d time.Duration) { sinkCloseWait = d }(sinkCloseWait)
+	sinkCloseWait = 20 * time.Millisecond
+
+	snd := &blockingSender{release: make(chan struct{})}
+	s := newAsyncSink("access", "test", snd, 16)
+	for range 5 {
+		s.enqueue([]byte("line\n"))
+	}
+	var once sync.Once
+	time.AfterFunc(100*time.Millisecond, func() { once.Do(func() { close(snd.release) }) })
+
+	start := time.Now()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("Close returned while Send was in flight")
+	}
+	if snd.raced.Load() || !snd.closed.Load() {
+		t.Fatalf("raced=%v closed=%v", snd.raced.Load(), snd.closed.Load())
+	}
+	st := s.Stats()
+	if st.Sent != 1 || st.Dropped != 4 {
+		t.Fatalf("stats %+v, want 1 sent and 4 dropped", st)
+	}
+	s.enqueue([]byte("after close\n")) // не паникует и не считается
+	if s.Stats().Dropped != 4 {
+		t.Fatal("enqueue after Close counted")
+	}
+}
@@ -34,12 +34,102 @@ func SysEndpoints(s *Server) {
 
 		sys.GET("/routes", func(c *gin.Context) {
 			routes := s.engine.Routes()
-			c.JSON(http.StatusOK, gin.H{"ok": true, "routes": routes})
+			out := make([]gin.H, 0, len(routes))
+			for _, rt := range routes {
+				policy, _ := s.cors.policyFor(rt.Path)
+				out = append(out, gin.H{
+					"method":  rt.Method,
+					"path":    rt.Path,
+					"handler": rt.Handler,
+					"cors":    policy,
+					"timeout": formatTimeout(s.timeouts.Effective(rt.Method, rt.Path)),
+				})
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true, "routes": out})
+		})
+
+		sys.GET("/concurrency", func(c *gin.Context) {
+			if s.concurrency == nil {
+				c.JSON(http.StatusOK, gin.H{"ok": true, "enabled": false})
+				return
+			}
+			out := s.concurrency.Stats()
+			out["ok"], out["enabled"] = true, true
+			c.JSON(http.StatusOK, out)
+		})
+
+		sys.GET("/logs/sinks", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"ok": true, "sinks": s.LogSinkStats()})
 		})
 
 		sys.GET("/routes/table", func(c *gin.Context) {
-			LogRoutes(s.engine) // печать в stdout
+			s.LogRoutes() // печать в stdout
 			c.JSON(http.StatusOK, gin.H{"ok": true})
 		})
 	}
+
+	// управляющие эндпоинты — только с токеном и правом AuthConfig.SysAdminPermission,
+	// без impersonation (X-Act-As не даёт чужих прав администратора)
+	admin := sys.Group("", s.auth.AccessMiddleware(), RequireNoActor(), RequirePermission(s.auth.cfg.SysAdminPermission))
+	logControlEndpoints(s, admin)
+	{
+		admin.POST("/logs/reopen", func(c *gin.Context) {
+			if err := s.ReopenLogs(); err != nil {
+				_ = c.Error(err)
+				RespondError(c, http.StatusInternalServerError, "reopen_failed", "logs reopen failed", nil)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+
+		// захват тел: {"enabled": true, "rate": 0.1, "duration": "10m"}
+		admin.GET("/capture", func(c *gin.Context) {
+			if s.capture == nil {
+				c.JSON(http.StatusOK, gin.H{"ok": true, "enabled": false})
+				return
+			}
+			out := s.capture.Stats()
+			out["ok"], out["enabled"] = true, true
+			c.JSON(http.StatusOK, out)
+		})
+
+		admin.PUT("/capture", func(c *gin.Context) {
+			if s.capture == nil {
+				RespondError(c, http.StatusConflict, "capture_disabled", "capture is not configured (CaptureConfig.File)", nil)
+				return
+			}
+			var req struct {
+				Enabled  bool     `json:"enabled"`
+				Rate     *float64 `json:"rate"`
+				Duration string   `json:"duration"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				RespondError(c, http.StatusBadRequest, "bad_request", err.Error(), nil)
+				return
+			}
+			rate, d := 1.0, 10*time.Minute
+			if req.Rate != nil {
+				rate = *req.Rate
+			}
+			if req.Duration != "" {
+				var err error
+				if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+					RespondError(c, http.StatusBadRequest, "bad_request", "invalid duration", nil)
+					return
+				}
+			}
+			if rate <= 0 || rate > 1 {
+				RespondError(c, http.StatusBadRequest, "bad_request", "rate must be in (0, 1]", nil)
+				return
+			}
+			if !req.Enabled {
+				d = 0
+			}
+			s.capture.Toggle(rate, d)
+			s.logger.Info("capture toggled", "module", "capture", "enabled", req.Enabled, "rate", rate, "duration", d.String())
+			out := s.capture.Stats()
+			out["ok"], out["enabled"] = true, true
+			c.JSON(http.StatusOK, out)
+		})
+	}
 }
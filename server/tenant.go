@@ -0,0 +1,332 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantKey — ключ tenant'а в gin.Context.
+const TenantKey = "tenant"
+
+type tenantCtxKey struct{}
+
+// WithTenant — положить tenant в context.Context (для сервисного слоя).
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext — tenant из context.Context ("" если нет).
+func TenantFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(tenantCtxKey{}).(string)
+	return t
+}
+
+// Tenant — tenant текущего запроса ("" если не определён).
+func Tenant(c *gin.Context) string {
+	if t := c.GetString(TenantKey); t != "" {
+		return t
+	}
+	return TenantFromContext(c.Request.Context())
+}
+
+func (t TenantConfig) enabled() bool {
+	return t.HostSuffix != "" || t.Header != "" || t.PathPrefix || t.Claim != ""
+}
+
+// tenantRejectKey — отказ, найденный Resolve; отвечает Middleware уже после CORS.
+const tenantRejectKey = "tenant_reject"
+
+// tenantsKey — tenants сервера для Auth из AuthOnly (см. Auth.tenantsFor).
+const tenantsKey = "tenants"
+
+type tenantReject struct {
+	status    int
+	code, msg string
+}
+
+// tenants — разрешение tenant'а и его настройки (CORS, лимиты).
+type tenants struct {
+	cfg      TenantConfig
+	basePath string
+	origins  map[string]*originMatcher
+	limits   map[string]RateLimit
+	// Auth сервера: Required+Claim берёт tenant из токена сам, не полагаясь
+	// на access мидлвар роута
+	auth *Auth
+}
+
+func newTenants(cfg TenantConfig, basePath string) (*tenants, error) {
+	if cfg.PathPrefix && basePath == "" {
+		return nil, errors.New("tenant: PathPrefix requires BasePath")
+	}
+	// иначе любой первый сегмент пути (BasePath/users/...) стал бы tenant'ом
+	if cfg.PathPrefix && len(cfg.Tenants) == 0 && cfg.Known == nil {
+		return nil, errors.New("tenant: PathPrefix requires Tenants or Known")
+	}
+	t := &tenants{
+		cfg:      cfg,
+		basePath: strings.TrimRight(basePath, "/"),
+		origins:  map[string]*originMatcher{},
+		limits:   map[string]RateLimit{},
+	}
+	// id в запросах приводятся к нижнему регистру — так же и ключи конфига
+	t.cfg.Tenants = make(map[string]TenantSettings, len(cfg.Tenants))
+	for raw, ts := range cfg.Tenants {
+		if !validTenantID(raw) {
+			return nil, errors.New("tenant: invalid id " + strconv.Quote(raw))
+		}
+		id := strings.ToLower(raw)
+		if _, dup := t.cfg.Tenants[id]; dup {
+			return nil, errors.New("tenant: duplicate id " + strconv.Quote(raw))
+		}
+		t.cfg.Tenants[id] = ts
+		if len(ts.AllowedOrigins) > 0 {
+			origins, _ := normalizeOrigins(ts.AllowedOrigins)
+			t.origins[id], _ = compileOrigins(origins, nil)
+		}
+		if ts.RateLimit > 0 {
+			burst := ts.RateBurst
+			if burst <= 0 {
+				burst = int(math.Ceil(ts.RateLimit))
+			}
+			// token bucket: burst токенов, пополнение RateLimit в секунду
+			t.limits[id] = RateLimit{
+				Algorithm: RateTokenBucket,
+				Limit:     burst,
+				Window:    time.Duration(float64(burst) / ts.RateLimit * float64(time.Second)),
+				Burst:     burst,
+			}
+		}
+	}
+	return t, nil
+}
+
+// Handler — вырезает {tenant} из BasePath/{tenant}/... до роутинга gin,
+// чтобы роуты регистрировались без tenant‑сегмента. Вырезаются только известные
+// (Tenants, Known); BasePath/livez и подобные (без хвоста) не трогаем.
+func (t *tenants) Handler(next http.Handler) http.Handler {
+	if !t.cfg.PathPrefix {
+		return next
+	}
+	prefix := t.basePath + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, tail, hasTail := strings.Cut(rest, "/")
+		if !hasTail || !validTenantID(id) || !t.known(strings.ToLower(id)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = r.WithContext(WithTenant(r.Context(), strings.ToLower(id)))
+		u := *r.URL
+		u.Path = t.basePath + "/" + tail
+		u.RawPath = ""
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Resolve — определяет tenant по path/host/header (все найденные источники
+// обязаны совпадать) до CORS, чтобы CORS видел origin'ы tenant'а. Отказы
+// не отдаются здесь: их отвечает Middleware после CORS, с CORS‑заголовками.
+func (t *tenants) Resolve() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id, rej := t.resolve(c); rej != nil {
+			c.Set(tenantRejectKey, rej)
+		} else if id != "" {
+			t.set(c, id)
+		}
+		c.Next()
+	}
+}
+
+// Middleware — отвечает отказом, найденным Resolve; ставится после CORS,
+// так что preflight'ы до него не доходят.
+func (t *tenants) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(tenantRejectKey); ok {
+			rej := v.(*tenantReject)
+			RespondError(c, rej.status, rej.code, rej.msg, nil)
+			return
+		}
+		c.Set(tenantsKey, t)
+		if Tenant(c) == "" && t.cfg.Required && !t.exempt(c.Request.URL.Path) {
+			if t.cfg.Claim == "" {
+				RespondError(c, http.StatusBadRequest, "tenant_required", "tenant required", nil)
+				return
+			}
+			// tenant из токена — здесь, а не в access мидлваре: его на роуте может не быть
+			if !t.checkClaims(c, t.tokenClaims(c)) {
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func (t *tenants) resolve(c *gin.Context) (string, *tenantReject) {
+	var found []string
+	if t.cfg.PathPrefix {
+		if id := TenantFromContext(c.Request.Context()); id != "" {
+			found = append(found, id)
+		}
+	}
+	if t.cfg.HostSuffix != "" {
+		if id := t.fromHost(c.Request.Host); id != "" {
+			found = append(found, id)
+		}
+	}
+	if t.cfg.Header != "" {
+		if id := strings.ToLower(strings.TrimSpace(c.GetHeader(t.cfg.Header))); id != "" {
+			if !validTenantID(id) {
+				return "", &tenantReject{http.StatusBadRequest, "invalid_tenant", "invalid tenant"}
+			}
+			found = append(found, id)
+		}
+	}
+	if len(found) == 0 {
+		return "", nil
+	}
+	for _, id := range found[1:] {
+		if id != found[0] {
+			return "", &tenantReject{http.StatusBadRequest, "tenant_mismatch", "conflicting tenant in request"}
+		}
+	}
+	if rej := t.check(found[0]); rej != nil {
+		return "", rej
+	}
+	return found[0], nil
+}
+
+// checkClaims — вызывается из AccessMiddleware (любого Auth, см. tenantsFor):
+// tenant в токене обязан совпадать с запрошенным; если в запросе tenant'а
+// не было — берём из токена.
+func (t *tenants) checkClaims(c *gin.Context, claims Claims) bool {
+	if t == nil || t.cfg.Claim == "" {
+		return true
+	}
+	tokTenant := strings.ToLower(claims.GetString(t.cfg.Claim))
+	cur := Tenant(c)
+	switch {
+	case cur != "" && tokTenant != "" && cur != tokTenant:
+		RespondError(c, http.StatusForbidden, "tenant_mismatch", "token does not belong to tenant", nil)
+		return false
+	case cur != "" && tokTenant == "" && t.cfg.Required:
+		RespondError(c, http.StatusForbidden, "tenant_mismatch", "token has no tenant", nil)
+		return false
+	case cur == "" && tokTenant != "":
+		if rej := t.check(tokTenant); rej != nil {
+			RespondError(c, rej.status, rej.code, rej.msg, nil)
+			return false
+		}
+		t.set(c, tokTenant)
+	case cur == "" && t.cfg.Required:
+		RespondError(c, http.StatusBadRequest, "tenant_required", "tenant required", nil)
+		return false
+	}
+	return true
+}
+
+// tokenClaims — клеймы access‑токена запроса через Auth сервера; nil — токена
+// нет или он невалиден (ответит access мидлвар, если он есть на роуте).
+func (t *tenants) tokenClaims(c *gin.Context) Claims {
+	if t.auth == nil {
+		return nil
+	}
+	tok := t.auth.pickToken(c, true)
+	if tok == "" {
+		return nil
+	}
+	claims, err := t.auth.validator.ValidateAccess(c, tok)
+	if err != nil {
+		return nil
+	}
+	return claims
+}
+
+// check — KnownOnly: неизвестные tenant'ы получают 404.
+func (t *tenants) check(id string) *tenantReject {
+	if t.cfg.KnownOnly && !t.known(id) {
+		return &tenantReject{http.StatusNotFound, "unknown_tenant", "unknown tenant"}
+	}
+	return nil
+}
+
+// set — фиксирует tenant в gin.Context и context.Context запроса.
+func (t *tenants) set(c *gin.Context, id string) {
+	c.Set(TenantKey, id)
+	if TenantFromContext(c.Request.Context()) != id {
+		c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), id))
+	}
+}
+
+// limitFor — лимит tenant'а из TenantSettings (применяет rateLimiter).
+func (t *tenants) limitFor(id string) (RateLimit, bool) {
+	if t == nil {
+		return RateLimit{}, false
+	}
+	l, ok := t.limits[id]
+	return l, ok
+}
+
+// known — id есть в Tenants или его одобрил Known.
+func (t *tenants) known(id string) bool {
+	if _, ok := t.cfg.Tenants[id]; ok {
+		return true
+	}
+	return t.cfg.Known != nil && t.cfg.Known(id)
+}
+
+// exempt — системные и health‑эндпоинты работают без tenant'а.
+func (t *tenants) exempt(path string) bool {
+	return systemPath(t.basePath, path)
+}
+
+// systemPath — /sys/* и health‑пробы: их не ограничиваем и не отбрасываем.
+func systemPath(basePath, path string) bool {
+	return strings.HasPrefix(path, "/sys/") ||
+		path == basePath+"/livez" || path == basePath+"/readyz"
+}
+
+// originsFor — дополнительные CORS‑origin'ы tenant'а запроса.
+func (t *tenants) originsFor(c *gin.Context) *originMatcher {
+	if t == nil {
+		return nil
+	}
+	return t.origins[Tenant(c)]
+}
+
+func (t *tenants) fromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	id, ok := strings.CutSuffix(host, "."+strings.ToLower(t.cfg.HostSuffix))
+	if !ok || !validTenantID(id) {
+		return ""
+	}
+	return id
+}
+
+func validTenantID(id string) bool {
+	if id == "" || len(id) > 63 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
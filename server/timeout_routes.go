@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutDisabled — значение в TimeoutConfig.Routes: роут без timeout'а (стриминг, SSE).
+const TimeoutDisabled time.Duration = -1
+
+// timeoutRouter — эффективный timeout роута: Routes.Timeout/RouteTimeout >
+// TimeoutConfig.Routes > глобальный.
+type timeoutRouter struct {
+	global   time.Duration
+	status   int
+	header   string        // заголовок с бюджетом клиента
+	min, max time.Duration // границы бюджета клиента
+	cfg      map[string]time.Duration
+	routes   routeTable[time.Duration]
+}
+
+func newTimeoutRouter(cfg TimeoutConfig) *timeoutRouter {
+	r := &timeoutRouter{
+		global: cfg.RequestTimeout,
+		status: cfg.GatewayTimeoutStatus,
+		header: cfg.ClientDeadlineHeader,
+		min:    cfg.ClientTimeoutMin,
+		max:    cfg.ClientTimeoutMax,
+		cfg:    cfg.Routes,
+		routes: newRouteTable(cfg.Routes),
+	}
+	if r.status == 0 {
+		r.status = http.StatusGatewayTimeout
+	}
+	return r
+}
+
+func (r *timeoutRouter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.run(c, r.Effective(c.Request.Method, c.FullPath()))
+	}
+}
+
+// run — остаток цепочки под серверным timeout'ом d, урезанным бюджетом клиента.
+// Роут без timeout'а (стриминг) получает дедлайн клиента только в контексте —
+// ответ не буферизуется и 504 не подменяется.
+func (r *timeoutRouter) run(c *gin.Context, d time.Duration) {
+	budget, ok := r.clientBudget(c)
+	switch {
+	case d > 0:
+		if ok && budget < d {
+			d = budget
+		}
+		runWithTimeout(c, d, r.status)
+	case ok:
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	default:
+		c.Next()
+	}
+}
+
+// clientBudget — бюджет из заголовка, зажатый в [min, max]. Нечитаемый заголовок
+// и бюджет <= 0 ("0", "0m") игнорируются — как если бы бюджета не было.
+func (r *timeoutRouter) clientBudget(c *gin.Context) (time.Duration, bool) {
+	if r.header == "" {
+		return 0, false
+	}
+	v := c.GetHeader(r.header)
+	if v == "" {
+		return 0, false
+	}
+	d, err := ParseDeadlineHeader(r.header, v)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	if d < r.min {
+		d = r.min
+	}
+	if r.max > 0 && d > r.max {
+		d = r.max
+	}
+	return d, true
+}
+
+// setRoutes — после регистрации: таблица конфига с записанным через Routes.
+func (r *timeoutRouter) setRoutes(code map[string]time.Duration) {
+	r.routes = newRouteTable(mergeRoutes(r.cfg, code))
+}
+
+// Effective — timeout роута (для таблицы роутов и мидлвара).
+func (r *timeoutRouter) Effective(method, fullPath string) time.Duration {
+	if d, ok := r.routes.lookup(method, fullPath); ok {
+		return d
+	}
+	return r.global
+}
+
+// formatTimeout — "3s", "off".
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "off"
+	}
+	return d.String()
+}
@@ -1,14 +1,28 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// TimeoutMiddleware — мягкий пер‑запросный timeout.
-// Инжектит дедлайн в c.Request.Context(); если истёк — возвращает 504 и прерывает цепочку.
+// TimeoutMiddleware — пер‑запросный timeout.
+// Инжектит дедлайн в c.Request.Context() и пишет ответ хендлеров в приватный
+// буфер: он уходит клиенту целиком, только если дедлайн не истёк, иначе —
+// 504 (запись хендлера после этого отбрасывается). Паника хендлера
+// пробрасывается в RecoveryJSON. Стриминг под этим мидлваром не работает
+// (Flush — no-op, Hijack — ошибка).
 func TimeoutMiddleware(cfg TimeoutConfig) gin.HandlerFunc {
 	d := cfg.RequestTimeout
 	if d <= 0 {
@@ -18,26 +32,192 @@ func TimeoutMiddleware(cfg TimeoutConfig) gin.HandlerFunc {
 	if status == 0 {
 		status = http.StatusGatewayTimeout
 	}
-	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
-		defer cancel()
+	return func(c *gin.Context) { runWithTimeout(c, d, status) }
+}
 
-		done := make(chan struct{})
-		req := c.Request.Clone(ctx) // копия с новым контекстом
-		c.Request = req
+// runWithTimeout — остаток цепочки c под дедлайном d.
+func runWithTimeout(c *gin.Context, d time.Duration, status int) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
 
-		go func() { c.Next(); close(done) }()
+	orig := c.Writer
+	tw := newTimeoutWriter(orig)
+	c.Writer = tw
 
-		select {
-		case <-done:
-			return
-		case <-ctx.Done():
-			// если хендлеры не успели ответить
-			if !c.Writer.Written() {
-				RespondError(c, status, "timeout", "request timed out", nil)
+	done := make(chan struct{})
+	var panicked *handlerPanic
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked = &handlerPanic{value: p, stack: debug.Stack()}
 			}
+			close(done)
+		}()
+		c.Next()
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	// хендлер, закончивший уже после дедлайна, тоже не коммитим
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		tw.markTimedOut()
+		// законченный ответ (Content-Length) уходит сразу: клиент получает 504
+		// целиком и не ждёт хендлер; соединение после него не переиспользуется
+		orig.Header().Set("Connection", "close")
+		writeErrorJSON(orig, status, "timeout", "request timed out")
+		orig.Flush()
+	}
+	// gin вернёт Context в пул после выхода из мидлвара — нельзя отпускать его,
+	// пока хендлер ещё работает с c (и после дедлайна, и после отмены клиентом).
+	// Ответ к этому моменту уже отправлен, ждёт только горутина сервера.
+	<-done
+	if timedOut {
+		Logger(c).Warn("request timed out", "module", LogModuleTimeout,
+			"method", c.Request.Method, "route", c.FullPath(), "timeout", d)
+	}
+
+	c.Writer = orig
+	if panicked != nil {
+		if tw.timedOut {
+			// ответ уже ушёл — RecoveryJSON писать некуда, просто логируем
+			_ = c.Error(fmt.Errorf("panic after timeout: %v\n%s", panicked.value, panicked.stack))
 			c.Abort()
 			return
 		}
+		panic(panicked) // RecoveryJSON достанет исходный стек
 	}
+	if tw.timedOut {
+		c.Abort()
+		return
+	}
+	tw.commit()
+}
+
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *handlerPanic) Error() string { return fmt.Sprint(p.value) }
+
+// timeoutWriter — буфер ответа хендлера. Header/Write/WriteHeader дёргает только
+// горутина хендлера; markTimedOut() и commit() — мидлвар, commit только после её выхода.
+// Семантика как у writer'а gin: WriteHeader запоминает статус, Written()
+// становится true только после Write/WriteHeaderNow.
+type timeoutWriter struct {
+	gin.ResponseWriter // исходный writer; используется только для CloseNotify
+
+	mu       sync.Mutex
+	h        http.Header
+	buf      bytes.Buffer
+	status   int
+	wrote    bool
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, h: w.Header().Clone(), status: http.StatusOK}
+}
+
+func (w *timeoutWriter) Header() http.Header { return w.h }
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if code > 0 && !w.wrote && !w.timedOut {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.wrote = true
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wrote = true
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) { return w.Write([]byte(s)) }
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wrote
+}
+
+func (w *timeoutWriter) Flush() {}
+
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported under TimeoutMiddleware")
+}
+
+func (w *timeoutWriter) Pusher() http.Pusher { return nil }
+
+// markTimedOut — дальше запись хендлера отбрасывается.
+func (w *timeoutWriter) markTimedOut() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+}
+
+// commit — перенести заголовки, статус и тело в настоящий writer.
+func (w *timeoutWriter) commit() {
+	dst := w.ResponseWriter
+	h := dst.Header()
+	for k := range h {
+		if _, ok := w.h[k]; !ok {
+			delete(h, k)
+		}
+	}
+	for k, v := range w.h {
+		h[k] = v
+	}
+	dst.WriteHeader(w.status)
+	if !w.wrote {
+		return
+	}
+	if w.buf.Len() > 0 {
+		_, _ = dst.Write(w.buf.Bytes())
+	} else {
+		dst.WriteHeaderNow()
+	}
+}
+
+// writeErrorJSON — то же тело, что у RespondError, но прямо в http.ResponseWriter
+// (когда gin.Context трогать нельзя).
+func writeErrorJSON(w http.ResponseWriter, status int, code, message string) {
+	b, _ := json.Marshal(errorBody(code, message, nil))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
 }
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Тесты рассчитаны на go test -race: хендлер продолжает работать с writer'ом
+// после того, как мидлвар уже ответил 504.
+
+func init() { gin.SetMode(gin.TestMode) }
+
+func timeoutEngine(d time.Duration, h gin.HandlerFunc) *gin.Engine {
+	e := gin.New()
+	e.Use(RecoveryJSON(io.Discard), TimeoutMiddleware(TimeoutConfig{RequestTimeout: d}))
+	e.GET("/", h)
+	return e
+}
+
+func serve(e *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestTimeoutCommitsFastHandler(t *testing.T) {
+	e := timeoutEngine(time.Second, func(c *gin.Context) {
+		c.Header("X-Handler", "1")
+		c.String(http.StatusCreated, "ok")
+	})
+	w := serve(e)
+	if w.Code != http.StatusCreated || w.Body.String() != "ok" || w.Header().Get("X-Handler") != "1" {
+		t.Fatalf("got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+}
+
+func TestTimeoutWriteAfterDeadline(t *testing.T) {
+	writeErr := make(chan error, 1)
+	e := timeoutEngine(20*time.Millisecond, func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		time.Sleep(10 * time.Millisecond) // мидлвар уже ответил
+		c.Header("X-Late", "1")
+		c.Status(http.StatusTeapot)
+		_, err := c.Writer.Write([]byte("late"))
+		writeErr <- err
+	})
+	w := serve(e)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want 504", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "late") || w.Header().Get("X-Late") != "" {
+		t.Fatalf("late write leaked: %q %v", w.Body.String(), w.Header())
+	}
+	if !strings.Contains(w.Body.String(), `"timeout"`) {
+		t.Fatalf("body %q", w.Body.String())
+	}
+	if err := <-writeErr; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Fatalf("late Write: %v, want ErrHandlerTimeout", err)
+	}
+}
+
+// TestTimeoutReleasesClient — 504 уходит законченным ответом по дедлайну,
+// даже если хендлер игнорирует ctx и работает дольше.
+func TestTimeoutReleasesClient(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(timeoutEngine(30*time.Millisecond, func(c *gin.Context) {
+		<-release
+	}))
+	defer func() { close(release); srv.Close() }()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el := time.Since(start); el > 500*time.Millisecond {
+		t.Fatalf("response finished after %v", el)
+	}
+	if resp.StatusCode != http.StatusGatewayTimeout || resp.ContentLength != int64(len(body)) || !resp.Close {
+		t.Fatalf("status %d, content-length %d (body %d), close %v", resp.StatusCode, resp.ContentLength, len(body), resp.Close)
+	}
+}
+
+// TestTimeoutClientCancel — клиент ушёл раньше дедлайна: мидлвар не отпускает
+// Context, пока хендлер с ним работает.
+func TestTimeoutClientCancel(t *testing.T) {
+	var finished atomic.Bool
+	e := timeoutEngine(time.Second, func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		c.Header("X-Late", "1")
+		finished.Store(true)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if !finished.Load() {
+		t.Fatal("middleware returned while the handler was running")
+	}
+}
+
+func TestTimeoutPanicAfterDeadline(t *testing.T) {
+	var errs []*gin.Error
+	e := gin.New()
+	e.Use(RecoveryJSON(io.Discard), func(c *gin.Context) {
+		c.Next()
+		errs = c.Errors
+	}, TimeoutMiddleware(TimeoutConfig{RequestTimeout: 20 * time.Millisecond}))
+	e.GET("/", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		panic("boom")
+	})
+	w := serve(e)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want 504", w.Code)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "panic after timeout: boom") {
+		t.Fatalf("errors %v", errs)
+	}
+}
+
+func TestTimeoutPanicBeforeDeadline(t *testing.T) {
+	e := timeoutEngine(time.Second, func(c *gin.Context) {
+		c.Header("X-Partial", "1")
+		panic("boom")
+	})
+	w := serve(e)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+	if w.Header().Get("X-Partial") != "" {
+		t.Fatalf("buffered header leaked: %v", w.Header())
+	}
+}
+
+// TestTimeoutConcurrentWriter — хендлер пишет заголовки и тело из нескольких горутин
+// (под своим mutex'ом, как требует http.Header), пока мидлвар отвечает 504
+// и читает Status/Written; много запросов параллельно.
+func TestTimeoutConcurrentWriter(t *testing.T) {
+	e := timeoutEngine(5*time.Millisecond, func(c *gin.Context) {
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for g := range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range 200 {
+					mu.Lock()
+					c.Writer.Header().Set(fmt.Sprintf("X-G%d", g), fmt.Sprint(i))
+					mu.Unlock()
+					_, _ = c.Writer.Write([]byte("x"))
+					_ = c.Writer.Status()
+					_ = c.Writer.Written()
+					if i%50 == 0 {
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		c.Status(http.StatusOK)
+	})
+
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := serve(e)
+			switch w.Code {
+			case http.StatusOK:
+				if w.Body.Len() != 800 {
+					t.Errorf("committed body %d bytes, want 800", w.Body.Len())
+				}
+			case http.StatusGatewayTimeout:
+				if strings.Contains(w.Body.String(), "xx") {
+					t.Errorf("handler body leaked into 504: %q", w.Body.String())
+				}
+			default:
+				t.Errorf("status %d", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+}